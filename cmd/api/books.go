@@ -5,36 +5,46 @@ import (
 	"Books/internal/validator"
 	"errors"
 	"fmt"
+	"github.com/julienschmidt/httprouter"
 	"net/http"
+	"net/url"
 )
 
-func (app *application) createBookHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Title    string     `json:"title"`
-		Authors  string     `json:"authors"`
-		ISBN     string     `json:"ISBN"`
-		ISBN13   string     `json:"ISBN13"`
-		Language string     `json:"language"`
-		Genres   []string   `json:"genres"`
-		Rating   float64    `json:"rating"`
-		Pages    data.Pages `json:"pages"`
+// bookInput is the JSON representation of a new book, shared by
+// createBookHandler and the NDJSON import.
+type bookInput struct {
+	Title       string           `json:"title"`
+	Authors     data.BookAuthors `json:"authors"`
+	ISBN        string           `json:"ISBN"`
+	ISBN13      string           `json:"ISBN13"`
+	Language    string           `json:"language"`
+	Description string           `json:"description"`
+	Genres      []string         `json:"genres"`
+	Pages       data.Pages       `json:"pages"`
+}
+
+func (input bookInput) book() *data.Book {
+	return &data.Book{
+		Title:       input.Title,
+		Authors:     input.Authors,
+		ISBN:        validator.NormalizeISBN(input.ISBN),
+		ISBN13:      validator.NormalizeISBN(input.ISBN13),
+		Language:    input.Language,
+		Description: input.Description,
+		Genres:      input.Genres,
+		Pages:       input.Pages,
 	}
+}
+
+func (app *application) createBookHandler(w http.ResponseWriter, r *http.Request) {
+	var input bookInput
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
-	book := &data.Book{
-		Title:    input.Title,
-		Authors:  input.Authors,
-		Rating:   input.Rating,
-		ISBN:     input.ISBN,
-		ISBN13:   input.ISBN13,
-		Language: input.Language,
-		Genres:   input.Genres,
-		Pages:    input.Pages,
-	}
+	book := input.book()
 
 	v := validator.New()
 
@@ -43,9 +53,18 @@ func (app *application) createBookHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.models.Books.Insert(book)
+	err = app.models.Books.Insert(book, app.contextGetUser(r).ID)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrUnknownAuthor):
+			v.AddError("authors", "must only reference existing author ids")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateISBN):
+			v.AddError("ISBN13", "a book with this ISBN13 already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 	headers := make(http.Header)
@@ -62,9 +81,27 @@ func (app *application) showBookHandler(w http.ResponseWriter, r *http.Request)
 	id, err := app.readIDParam(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	fields := app.readFields(qs, "fields", bookFieldSafelist, v)
+	include := app.readFields(qs, "include", bookIncludes, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
 	}
 
-	books, err := app.models.Books.Get(id)
+	// A sparse book only needs its fields, the ones its entity tag is derived
+	// from and the authors if they are embedded.
+	var book *data.Book
+	if len(fields) > 0 {
+		book, err = app.models.Books.GetFields(id, fields, append([]string{"version", "rating", "rating_count"}, include...)...)
+	} else {
+		book, err = app.models.Books.Get(id)
+	}
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -75,7 +112,62 @@ func (app *application) showBookHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"book": books}, nil)
+	env := envelope{"book": book}
+	etag := bookETag(book)
+	if len(fields) > 0 || len(include) > 0 {
+		resources, err := app.bookResources([]*data.Book{book}, fields, include)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		env["book"] = resources[0]
+
+		reviews, _ := resources[0]["reviews"].([]*data.Review)
+		etag = sparseBookETag(book, fields, include, reviews)
+	}
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag, true) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+
+	err = app.writeJSON(w, http.StatusOK, env, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showBookByISBNHandler(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	isbn := validator.NormalizeISBN(params.ByName("isbn"))
+
+	switch {
+	case validator.ValidISBN10(isbn):
+		isbn = validator.ISBN10To13(isbn)
+	case validator.ValidISBN13(isbn):
+	default:
+		v := validator.New()
+		v.AddError("isbn", "must be a valid ISBN-10 or ISBN-13")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	book, err := app.models.Books.GetByISBN13(isbn)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"book": book}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -98,15 +190,20 @@ func (app *application) updateBookHandler(w http.ResponseWriter, r *http.Request
 		}
 		return
 	}
+
+	if !app.checkIfMatch(w, r, book) {
+		return
+	}
+
 	var input struct {
-		Title    *string     `json:"title"`
-		Authors  *string     `json:"authors"`
-		ISBN     *string     `json:"ISBN"`
-		ISBN13   *string     `json:"ISBN13"`
-		Language *string     `json:"language"`
-		Genres   []string    `json:"genres"`
-		Rating   *float64    `json:"rating"`
-		Pages    *data.Pages `json:"pages"`
+		Title       *string          `json:"title"`
+		Authors     data.BookAuthors `json:"authors"`
+		ISBN        *string          `json:"ISBN"`
+		ISBN13      *string          `json:"ISBN13"`
+		Language    *string          `json:"language"`
+		Description *string          `json:"description"`
+		Genres      []string         `json:"genres"`
+		Pages       *data.Pages      `json:"pages"`
 	}
 
 	err = app.readJSON(w, r, &input)
@@ -119,20 +216,20 @@ func (app *application) updateBookHandler(w http.ResponseWriter, r *http.Request
 		book.Title = *input.Title
 	}
 	if input.Authors != nil {
-		book.Authors = *input.Authors
-	}
-	if input.Rating != nil {
-		book.Rating = *input.Rating
+		book.Authors = input.Authors
 	}
 	if input.ISBN != nil {
-		book.ISBN = *input.ISBN
+		book.ISBN = validator.NormalizeISBN(*input.ISBN)
 	}
 	if input.ISBN13 != nil {
-		book.ISBN13 = *input.ISBN13
+		book.ISBN13 = validator.NormalizeISBN(*input.ISBN13)
 	}
 	if input.Language != nil {
 		book.Language = *input.Language
 	}
+	if input.Description != nil {
+		book.Description = *input.Description
+	}
 	if input.Genres != nil {
 		book.Genres = input.Genres
 	}
@@ -146,9 +243,15 @@ func (app *application) updateBookHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.models.Books.Update(book)
+	err = app.models.Books.Update(book, app.contextGetUser(r).ID)
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrUnknownAuthor):
+			v.AddError("authors", "must only reference existing author ids")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateISBN):
+			v.AddError("ISBN13", "a book with this ISBN13 already exists")
+			app.failedValidationResponse(w, r, v.Errors)
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
 		default:
@@ -157,7 +260,10 @@ func (app *application) updateBookHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"book": book}, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", bookETag(book))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"book": book}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -170,53 +276,330 @@ func (app *application) deleteBookHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.models.Books.Delete(id)
+	// With If-Match, the book is only deleted if it is still at the version
+	// the header was checked against.
+	var version int32
+	if r.Header.Get("If-Match") != "" {
+		book, err := app.models.Books.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if !app.checkIfMatch(w, r, book) {
+			return
+		}
+		version = book.Version
+	}
+
+	err = app.models.Books.Delete(id, version, app.contextGetUser(r).ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "book successfully deleted"}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "book successfully moved to trash"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
-func (app *application) listBooksHandler(w http.ResponseWriter, r *http.Request) {
+func (app *application) listTrashedBooksHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title  string
-		Genres []string
 		data.Filters
 	}
 
 	v := validator.New()
 	qs := r.URL.Query()
 
-	input.Title = app.readString(qs, "title", "")
-	input.Genres = app.readCSV(qs, "genres", []string{})
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
-	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafelist = []string{"id", "title", "pages", "rating", "-id", "-title", "-pages", "-rating"}
+	input.Filters.Sort = app.readString(qs, "sort", "-deleted_at")
+	input.Filters.SortSafelist = []string{"id", "title", "deleted_at", "-id", "-title", "-deleted_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	books, metadata, err := app.models.Books.GetAllDeleted(input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"books": books, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) restoreBookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	book, err := app.models.Books.Restore(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"book": book}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) purgeBookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Books.Purge(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrBookHasCopies):
+			app.bookHasCopiesResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "book permanently deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readBookFilters reads the query string parameters that narrow down a book
+// listing.
+func (app *application) readBookFilters(qs url.Values, v *validator.Validator) data.BookFilters {
+	return data.BookFilters{
+		Title:         app.readString(qs, "title", ""),
+		Query:         app.readString(qs, "q", ""),
+		Genres:        app.readCSV(qs, "genres", []string{}),
+		GenresMode:    app.readString(qs, "genres_mode", data.GenresModeAll),
+		Language:      app.readString(qs, "language", ""),
+		Authors:       app.readCSV(qs, "authors", []string{}),
+		MinRating:     app.readFloat(qs, "min_rating", 0, v),
+		MaxRating:     app.readFloat(qs, "max_rating", 0, v),
+		MinPages:      app.readInt(qs, "min_pages", 0, v),
+		MaxPages:      app.readInt(qs, "max_pages", 0, v),
+		CreatedAfter:  app.readTime(qs, "created_after", v),
+		CreatedBefore: app.readTime(qs, "created_before", v),
+	}
+}
+
+// readBookListing reads the filters, sparse fieldset and pagination of a book
+// listing and validates them along with the sort and cursor parameters.
+// Relevance sort needs a search term: the q parameter or, with fuzzy
+// matching, the title.
+func (app *application) readBookListing(qs url.Values, fuzzy bool, v *validator.Validator) (data.BookFilters, data.Filters) {
+	bookFilters := app.readBookFilters(qs, v)
+	bookFilters.Fields = app.readFields(qs, "fields", bookFieldSafelist, v)
+
+	filters := data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 20, v),
+		Sort:         app.readString(qs, "sort", "id"),
+		SortSafelist: bookSortSafelist,
+		Cursor:       app.readString(qs, "cursor", ""),
+	}
+
+	term := bookFilters.Query
+	if fuzzy && term == "" {
+		term = bookFilters.Title
+	}
+
+	v.Check(filters.Cursor == "" || !qs.Has("page"), "cursor", "must not be used together with page")
+	v.Check(filters.Sort != "relevance" || term != "", "sort", "relevance requires the q parameter")
+	v.Check(filters.Sort != "relevance" || filters.Cursor == "", "cursor", "is not supported with relevance sort")
+
+	data.ValidateBookFilters(v, bookFilters)
+	data.ValidateFilters(v, filters)
+
+	return bookFilters, filters
+}
+
+func (app *application) listBooksHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.BookFilters
+		Fuzzy   bool
+		Facets  []string
+		Include []string
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Fuzzy = app.readBool(qs, "fuzzy", false, v)
+	input.Facets = app.readCSV(qs, "facets", []string{})
+	input.Include = app.readFields(qs, "include", bookIncludes, v)
+	input.BookFilters, input.Filters = app.readBookListing(qs, input.Fuzzy, v)
+
+	// Fuzzy matching and "did you mean" suggestions work on whichever search
+	// term the client sent.
+	term := input.Query
+	if term == "" {
+		term = input.Title
+	}
+
+	v.Check(!input.Fuzzy || term != "", "fuzzy", "requires the q or title parameter")
+	v.Check(!input.Fuzzy || input.Filters.Cursor == "", "cursor", "is not supported in fuzzy mode")
+	v.Check(!input.Fuzzy || len(input.Facets) == 0, "facets", "are not supported in fuzzy mode")
+	for _, facet := range input.Facets {
+		v.Check(validator.PermittedValue(facet, data.FacetNames...), "facets", "must only contain genres, language, rating or pages")
+	}
+	v.Check(validator.Unique(input.Facets), "facets", "must not contain duplicate values")
 
 	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	books, metadata, err := app.models.Books.GetAll(input.Title, input.Genres, input.Filters)
+	// Authors are loaded with the books, so including them just selects them
+	// alongside a sparse fieldset.
+	if len(input.Fields) > 0 && validator.PermittedValue("authors", input.Include...) {
+		input.BookFilters.Fields = append(input.BookFilters.Fields, "authors")
+	}
+
+	var (
+		books    []*data.Book
+		metadata data.Metadata
+		err      error
+	)
+	if input.Fuzzy {
+		books, metadata, err = app.models.Books.GetAllFuzzy(term, input.BookFilters, input.Filters)
+	} else {
+		books, metadata, err = app.models.Books.GetAll(input.BookFilters, input.Filters)
+	}
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"movies": books, "metadata": metadata}, nil)
+
+	env := envelope{"movies": books, "metadata": metadata}
+	if len(input.Fields) > 0 || len(input.Include) > 0 {
+		resources, err := app.bookResources(books, input.Fields, input.Include)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		env["movies"] = resources
+	}
+
+	if len(input.Facets) > 0 {
+		facets, err := app.models.Books.GetFacets(input.BookFilters, input.Facets)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		env["facets"] = facets
+	}
+
+	if !input.Fuzzy && term != "" && len(books) == 0 && input.Filters.Page == 1 && input.Filters.Cursor == "" {
+		suggestions, err := app.models.Books.Suggest(term, 5)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		env["suggestions"] = suggestions
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 
 }
+
+// bookFieldSafelist are the fields a book response can be cut down to.
+var bookFieldSafelist = append([]string{"highlights", "similarity"}, data.BookFields...)
+
+// bookSortSafelist are the orders a book listing can be sorted in.
+var bookSortSafelist = []string{"id", "title", "pages", "rating", "relevance", "-id", "-title", "-pages", "-rating"}
+
+// bookIncludes are the related resources that can be embedded in a book.
+var bookIncludes = []string{"authors", "reviews", "revisions"}
+
+// includedRevisions and includedReviews are how many of the latest revisions
+// and reviews of a book are embedded by include=revisions and
+// include=reviews.
+const (
+	includedRevisions = 5
+	includedReviews   = 5
+)
+
+// bookResources cuts books down to fields and embeds the related resources
+// named in include.
+func (app *application) bookResources(books []*data.Book, fields, include []string) ([]resource, error) {
+	resources := newResources(books, fields)
+
+	if validator.PermittedValue("authors", include...) {
+		for i, book := range books {
+			resources[i]["authors"] = book.Authors
+		}
+	}
+
+	ids := make([]int64, len(books))
+	for i, book := range books {
+		ids[i] = book.ID
+	}
+
+	if validator.PermittedValue("reviews", include...) {
+		reviews, err := app.models.Reviews.GetLatestForBooks(ids, includedReviews)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, book := range books {
+			bookReviews := reviews[book.ID]
+			if bookReviews == nil {
+				bookReviews = []*data.Review{}
+			}
+			resources[i]["reviews"] = bookReviews
+		}
+	}
+
+	if validator.PermittedValue("revisions", include...) {
+		revisions, err := app.models.Revisions.GetLatestForBooks(ids, includedRevisions)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, book := range books {
+			bookRevisions := revisions[book.ID]
+			if bookRevisions == nil {
+				bookRevisions = []*data.BookRevision{}
+			}
+			resources[i]["revisions"] = bookRevisions
+		}
+	}
+	return resources, nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"strings"
 )
 
 func (app *application) logError(r *http.Request, err error) {
@@ -51,7 +52,69 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
 
+func (app *application) authorInUseResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the author is still linked to one or more books"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) builtInShelfResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the built-in shelves can't be renamed or deleted"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) copyOnLoanResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the copy is out on loan, it has to be returned first"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) copyOnHoldResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the copy is kept for another user's hold"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) bookHasCopiesResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the book has library copies, which keep its loan history, so it can't be purged"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the resource has been modified since you last fetched it, please fetch it again"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, supported ...string) {
+	message := fmt.Sprintf("the Content-Type must be one of %s", strings.Join(supported, ", "))
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
+
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
 	message := "rate limit exceeded"
 	app.errorResponse(w, r, http.StatusTooManyRequests, message)
 }
+
+func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid authentication credentials"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+
+	message := "invalid or missing authentication token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "you must be authenticated to access this resource"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account must be activated to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account doesn't have the necessary permissions to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"Books/internal/data"
+	"Books/internal/validator"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	exportCSV    = "csv"
+	exportNDJSON = "ndjson"
+	exportJSON   = "json"
+)
+
+var exportContentTypes = map[string]string{
+	exportCSV:    "text/csv; charset=utf-8",
+	exportNDJSON: "application/x-ndjson",
+	exportJSON:   "application/json",
+}
+
+// exportFlushEvery is how many books are written between flushes of the
+// response, so that clients see the download progress.
+const exportFlushEvery = 500
+
+// bookEncoder streams books to the client in one of the export formats. It
+// only writes the response headers along with the first book, or in finish,
+// so that an error before then can still be answered with an error response.
+type bookEncoder struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	format  string
+	fields  []string
+	csv     *csv.Writer
+	started bool
+	n       int
+}
+
+func newBookEncoder(w http.ResponseWriter, format string, fields []string) *bookEncoder {
+	enc := &bookEncoder{
+		w:      w,
+		rc:     http.NewResponseController(w),
+		format: format,
+		fields: fields,
+	}
+	if format == exportCSV {
+		enc.csv = csv.NewWriter(w)
+		if len(enc.fields) == 0 {
+			enc.fields = data.BookFields
+		}
+	}
+	return enc
+}
+
+func (enc *bookEncoder) start() error {
+	enc.started = true
+
+	filename := fmt.Sprintf("books-%s.%s", time.Now().UTC().Format(time.DateOnly), enc.format)
+	enc.w.Header().Set("Content-Type", exportContentTypes[enc.format])
+	enc.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	enc.w.WriteHeader(http.StatusOK)
+
+	switch enc.format {
+	case exportCSV:
+		return enc.csv.Write(enc.fields)
+	case exportJSON:
+		_, err := enc.w.Write([]byte(`{"books":[`))
+		return err
+	}
+	return nil
+}
+
+func (enc *bookEncoder) encode(book *data.Book) error {
+	if !enc.started {
+		if err := enc.start(); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	switch enc.format {
+	case exportCSV:
+		record := make([]string, len(enc.fields))
+		for i, field := range enc.fields {
+			record[i] = csvBookField(book, field)
+		}
+		err = enc.csv.Write(record)
+	default:
+		err = enc.writeJSON(book)
+	}
+	if err != nil {
+		return err
+	}
+
+	enc.n++
+	if enc.n%exportFlushEvery == 0 {
+		return enc.flush()
+	}
+	return nil
+}
+
+func (enc *bookEncoder) writeJSON(book *data.Book) error {
+	var value any = book
+	if len(enc.fields) > 0 {
+		value = newResource(book, enc.fields)
+	}
+
+	js, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case enc.format == exportNDJSON:
+		js = append(js, '\n')
+	case enc.n > 0:
+		js = append([]byte{','}, js...)
+	}
+
+	_, err = enc.w.Write(js)
+	return err
+}
+
+func (enc *bookEncoder) flush() error {
+	if enc.csv != nil {
+		enc.csv.Flush()
+		if err := enc.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return enc.rc.Flush()
+}
+
+// finish writes whatever the format needs after the last book.
+func (enc *bookEncoder) finish() error {
+	if !enc.started {
+		if err := enc.start(); err != nil {
+			return err
+		}
+	}
+
+	if enc.format == exportJSON {
+		if _, err := enc.w.Write([]byte("]}\n")); err != nil {
+			return err
+		}
+	}
+	return enc.flush()
+}
+
+// csvBookField formats one field of a book as a CSV value, in the format
+// importBooksHandler reads back.
+func csvBookField(book *data.Book, field string) string {
+	switch field {
+	case "id":
+		return strconv.FormatInt(book.ID, 10)
+	case "title":
+		return book.Title
+	case "authors":
+		return book.Authors.Names()
+	case "rating":
+		return strconv.FormatFloat(book.Rating, 'f', -1, 64)
+	case "rating_count":
+		return strconv.Itoa(book.RatingCount)
+	case "ISBN":
+		return book.ISBN
+	case "ISBN13":
+		return book.ISBN13
+	case "language":
+		return book.Language
+	case "description":
+		return book.Description
+	case "genres":
+		return strings.Join(book.Genres, ", ")
+	case "pages":
+		return strconv.Itoa(int(book.Pages))
+	case "version":
+		return strconv.Itoa(int(book.Version))
+	default:
+		return ""
+	}
+}
+
+func (app *application) exportBooksHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.BookFilters
+		Format string
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.BookFilters = app.readBookFilters(qs, v)
+	input.Fields = app.readFields(qs, "fields", data.BookFields, v)
+	input.Format = app.readString(qs, "format", exportJSON)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafelist = bookSortSafelist
+
+	v.Check(validator.PermittedValue(input.Format, exportCSV, exportNDJSON, exportJSON), "format", "must be one of csv, ndjson or json")
+	v.Check(validator.PermittedValue(input.Filters.Sort, input.Filters.SortSafelist...), "sort", "invalid sort value")
+	v.Check(input.Filters.Sort != "relevance" || input.Query != "", "sort", "relevance requires the q parameter")
+
+	if data.ValidateBookFilters(v, input.BookFilters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	app.extendDeadlines(w, app.config.exports.timeout)
+
+	enc := newBookEncoder(w, input.Format, input.Fields)
+
+	err := app.models.Books.Export(r.Context(), input.BookFilters, input.Filters, enc.encode)
+	if err == nil {
+		err = enc.finish()
+	}
+	if err != nil {
+		if !enc.started {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// The status line has gone out already, so the best we can do is cut
+		// the download short rather than let it look complete.
+		app.logError(r, err)
+		panic(http.ErrAbortHandler)
+	}
+}
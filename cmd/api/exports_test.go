@@ -0,0 +1,115 @@
+package main
+
+import (
+	"Books/internal/data"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBookEncoder(t *testing.T) {
+	books := []*data.Book{
+		{ID: 1, Title: "Dune", Authors: data.BookAuthors{{Name: "Frank Herbert"}}, Genres: []string{"classics"}, Pages: 412, Version: 1},
+		{ID: 2, Title: "Emma, a Novel", Rating: 4.5, RatingCount: 2, Version: 3},
+	}
+
+	tests := []struct {
+		format      string
+		fields      []string
+		contentType string
+		want        string
+	}{
+		{exportCSV, []string{"id", "title", "rating"}, "text/csv; charset=utf-8",
+			"id,title,rating\n1,Dune,0\n2,\"Emma, a Novel\",4.5\n"},
+		{exportNDJSON, []string{"id", "title"}, "application/x-ndjson",
+			`{"id":1,"title":"Dune"}` + "\n" + `{"id":2,"title":"Emma, a Novel"}` + "\n"},
+		{exportJSON, []string{"id"}, "application/json",
+			`{"books":[{"id":1},{"id":2}]}` + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			enc := newBookEncoder(rr, tt.format, tt.fields)
+
+			for _, book := range books {
+				if err := enc.encode(book); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := enc.finish(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := rr.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("got Content-Type %q; want %q", got, tt.contentType)
+			}
+			if got := rr.Body.String(); got != tt.want {
+				t.Errorf("got body %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBookEncoderEmpty(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{exportCSV, strings.Join(data.BookFields, ",") + "\n"},
+		{exportNDJSON, ""},
+		{exportJSON, `{"books":[]}` + "\n"},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		enc := newBookEncoder(rr, tt.format, nil)
+
+		if err := enc.finish(); err != nil {
+			t.Fatal(err)
+		}
+		if got := rr.Body.String(); got != tt.want {
+			t.Errorf("%s: got body %q; want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+// The CSV export has to read back in as the same books through the CSV
+// import.
+func TestCSVExportRoundTrip(t *testing.T) {
+	book := &data.Book{
+		Title:       "Dune",
+		Authors:     data.BookAuthors{{Name: "Frank Herbert"}, {Name: "Brian Herbert"}},
+		ISBN:        "0441013597",
+		ISBN13:      "9780441013593",
+		Language:    "English",
+		Description: "Spice, \"sand\" and worms",
+		Genres:      []string{"science fiction", "classics"},
+		Pages:       412,
+	}
+
+	rr := httptest.NewRecorder()
+	enc := newBookEncoder(rr, exportCSV, nil)
+	if err := enc.encode(book); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	cr, err := newCSVBookReader(rr.Body, bookCSVRecord, "title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := readRows(t, cr)
+
+	if len(rows) != 1 || !rows[0].v.Valid() {
+		t.Fatalf("got rows %+v", rows)
+	}
+	got := rows[0].book
+	if got.Title != book.Title || got.Authors.Names() != book.Authors.Names() || got.ISBN13 != book.ISBN13 ||
+		got.Description != book.Description || strings.Join(got.Genres, "|") != strings.Join(book.Genres, "|") ||
+		got.Pages != book.Pages {
+		t.Errorf("got %+v; want %+v", got, book)
+	}
+}
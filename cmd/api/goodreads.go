@@ -0,0 +1,144 @@
+package main
+
+import (
+	"Books/internal/data"
+	"Books/internal/validator"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// goodreadsShelves maps the reading shelves of a Goodreads export to ours.
+var goodreadsShelves = map[string]string{
+	"to-read":           data.ShelfWantToRead,
+	"currently-reading": data.ShelfCurrentlyReading,
+	"read":              data.ShelfRead,
+}
+
+// goodreadsValue strips the ="..." quoting Goodreads wraps around ISBNs to
+// keep spreadsheets from mangling them.
+func goodreadsValue(s string) string {
+	if strings.HasPrefix(s, `="`) && strings.HasSuffix(s, `"`) && len(s) >= 3 {
+		return s[2 : len(s)-1]
+	}
+	return s
+}
+
+// goodreadsCSVRecord maps a row of a Goodreads library export. The export has
+// no language column, so every book gets the given language. The Author
+// column holds a single name, which may itself contain a comma, while
+// Additional Authors is a comma-separated list. Bookshelves
+// other than the reading shelves become the genres of the book, up to the
+// five a book can have.
+func goodreadsCSVRecord(language string) csvRowMapper {
+	return func(rec csvRecord, row *importRow) {
+		book := &data.Book{
+			Title:    rec.get("title"),
+			ISBN:     validator.NormalizeISBN(goodreadsValue(rec.get("isbn"))),
+			ISBN13:   validator.NormalizeISBN(goodreadsValue(rec.get("isbn13"))),
+			Language: language,
+		}
+
+		if book.ISBN13 == "" && validator.ValidISBN10(book.ISBN) {
+			book.ISBN13 = validator.ISBN10To13(book.ISBN)
+		}
+
+		var names []string
+		if name := rec.get("author"); name != "" {
+			names = append(names, name)
+		}
+		for _, name := range append(names, splitList(rec.get("additional authors"))...) {
+			book.Authors = append(book.Authors, data.BookAuthor{Name: name})
+		}
+
+		for _, shelf := range splitList(rec.get("bookshelves")) {
+			if _, ok := goodreadsShelves[shelf]; ok || len(book.Genres) == 5 {
+				continue
+			}
+			book.Genres = append(book.Genres, shelf)
+		}
+
+		if s := rec.get("average rating"); s != "" {
+			rating, err := strconv.ParseFloat(s, 64)
+			row.v.Check(err == nil && rating >= 0 && rating <= 5, "rating", "must be a number between 0 and 5")
+			book.Rating = rating
+		}
+
+		if s := rec.get("number of pages"); s != "" {
+			pages, err := strconv.ParseInt(s, 10, 32)
+			row.v.Check(err == nil, "pages", "must be an integer value")
+			book.Pages = data.Pages(pages)
+		}
+
+		if s := rec.get("my rating"); s != "" {
+			rating, err := strconv.Atoi(s)
+			row.v.Check(err == nil && rating >= 0 && rating <= 5, "my_rating", "must be an integer between 0 and 5")
+			row.myRating = rating
+		}
+
+		row.shelf = strings.ToLower(rec.get("exclusive shelf"))
+		if shelf, ok := goodreadsShelves[row.shelf]; ok {
+			row.shelf = shelf
+		} else if row.shelf != "" {
+			data.ValidateShelfName(row.v, "shelf", row.shelf)
+		}
+
+		row.book = book
+	}
+}
+
+// importGoodreadsHandler imports a Goodreads library export. Books that are
+// already in the catalog are matched by ISBN-13 instead of being added again,
+// and every book lands on the shelf it was on in Goodreads, along with the
+// user's own rating of it. Only users who can write books add the missing
+// ones to the catalog; for everybody else those rows are rejected.
+func (app *application) importGoodreadsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	dryRun := app.readBool(qs, "dry_run", false, v)
+	language := app.readString(qs, "language", "English")
+	v.Check(language != "", "language", "must be provided")
+	v.Check(len(language) <= 20, "language", "must not be more than 20 bytes long")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "text/csv" {
+		app.unsupportedMediaTypeResponse(w, r, "text/csv")
+		return
+	}
+
+	app.extendDeadlines(w, app.config.imports.timeout)
+	body := http.MaxBytesReader(w, r.Body, app.config.imports.maxBytes)
+
+	cr, err := newCSVBookReader(body, goodreadsCSVRecord(language), "title", "author", "isbn", "isbn13")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	imp := app.newBookImporter(user.ID, dryRun)
+	imp.dedupe = true
+	imp.matchOnly = !permissions.Include("books:write")
+	imp.shelve = true
+
+	readErr, err := imp.run(cr)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	imp.respond(w, r, readErr)
+}
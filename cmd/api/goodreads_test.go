@@ -0,0 +1,168 @@
+package main
+
+import (
+	"Books/internal/data"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGoodreadsValue(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{`="0441013597"`, "0441013597"},
+		{`=""`, ""},
+		{"0441013597", "0441013597"},
+		{`="`, `="`},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := goodreadsValue(tt.s); got != tt.want {
+			t.Errorf("goodreadsValue(%q) = %q; want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestGoodreadsCSVRecord(t *testing.T) {
+	const header = "Book Id,Title,Author,Additional Authors,ISBN,ISBN13,My Rating,Average Rating,Number of Pages,Bookshelves,Exclusive Shelf\n"
+
+	tests := []struct {
+		name     string
+		row      string
+		authors  []string
+		isbn13   string
+		genres   []string
+		pages    data.Pages
+		shelf    string
+		myRating int
+		rating   float64
+		errors   map[string]string
+	}{
+		{
+			name:     "read",
+			row:      `1,Dune,Frank Herbert,,"=""0441013597""","=""9780441013593""",5,4.27,412,"read, classics, science-fiction",read`,
+			authors:  []string{"Frank Herbert"},
+			isbn13:   "9780441013593",
+			genres:   []string{"classics", "science-fiction"},
+			pages:    412,
+			shelf:    data.ShelfRead,
+			myRating: 5,
+			rating:   4.27,
+			errors:   map[string]string{},
+		},
+		{
+			name:    "comma in author",
+			row:     `2,The Hobbit,"Tolkien, J.R.R.","Lee, Alan, Anderson, Douglas A.",,,0,4.28,,to-read,to-read`,
+			authors: []string{"Tolkien, J.R.R.", "Lee", "Alan", "Anderson", "Douglas A."},
+			shelf:   data.ShelfWantToRead,
+			rating:  4.28,
+			errors:  map[string]string{},
+		},
+		{
+			name:    "ISBN-13 from ISBN-10",
+			row:     `3,Dune,Frank Herbert,,"=""0441013597""","=""""",,,,,currently-reading`,
+			authors: []string{"Frank Herbert"},
+			isbn13:  "9780441013593",
+			shelf:   data.ShelfCurrentlyReading,
+			errors:  map[string]string{},
+		},
+		{
+			name:    "custom shelf",
+			row:     `4,Dune,Frank Herbert,,,,,,,,Did-Not-Finish`,
+			authors: []string{"Frank Herbert"},
+			shelf:   "did-not-finish",
+			errors:  map[string]string{},
+		},
+		{
+			name:    "shelf with a slash",
+			row:     `5,Dune,Frank Herbert,,,,,,,,dnf/2023`,
+			authors: []string{"Frank Herbert"},
+			shelf:   "dnf/2023",
+			errors:  map[string]string{"shelf": "must not contain slashes"},
+		},
+		{
+			name:    "long shelf",
+			row:     `6,Dune,Frank Herbert,,,,,,,,` + strings.Repeat("x", 101),
+			authors: []string{"Frank Herbert"},
+			shelf:   strings.Repeat("x", 101),
+			errors:  map[string]string{"shelf": "must not be more than 100 bytes long"},
+		},
+		{
+			name:    "bad numbers",
+			row:     `7,Dune,Frank Herbert,,,,6,high,lots,,`,
+			authors: []string{"Frank Herbert"},
+			errors: map[string]string{
+				"rating":    "must be a number between 0 and 5",
+				"pages":     "must be an integer value",
+				"my_rating": "must be an integer between 0 and 5",
+			},
+			myRating: 6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr, err := newCSVBookReader(strings.NewReader(header+tt.row+"\n"), goodreadsCSVRecord("English"), "title", "author", "isbn", "isbn13")
+			if err != nil {
+				t.Fatal(err)
+			}
+			rows := readRows(t, cr)
+			if len(rows) != 1 {
+				t.Fatalf("got %d rows; want 1", len(rows))
+			}
+			row := rows[0]
+
+			if !reflect.DeepEqual(row.v.Errors, tt.errors) {
+				t.Errorf("got errors %v; want %v", row.v.Errors, tt.errors)
+			}
+
+			var authors []string
+			for _, author := range row.book.Authors {
+				authors = append(authors, author.Name)
+			}
+			if !reflect.DeepEqual(authors, tt.authors) {
+				t.Errorf("got authors %q; want %q", authors, tt.authors)
+			}
+
+			if row.book.ISBN13 != tt.isbn13 {
+				t.Errorf("got ISBN13 %q; want %q", row.book.ISBN13, tt.isbn13)
+			}
+			if !reflect.DeepEqual(row.book.Genres, tt.genres) {
+				t.Errorf("got genres %q; want %q", row.book.Genres, tt.genres)
+			}
+			if row.book.Pages != tt.pages {
+				t.Errorf("got %d pages; want %d", row.book.Pages, tt.pages)
+			}
+			if row.book.Language != "English" {
+				t.Errorf("got language %q", row.book.Language)
+			}
+			if row.shelf != tt.shelf {
+				t.Errorf("got shelf %q; want %q", row.shelf, tt.shelf)
+			}
+			if row.myRating != tt.myRating {
+				t.Errorf("got rating %d; want %d", row.myRating, tt.myRating)
+			}
+			if row.book.Rating != tt.rating {
+				t.Errorf("got average rating %g; want %g", row.book.Rating, tt.rating)
+			}
+		})
+	}
+}
+
+func TestGoodreadsCSVRecordGenreLimit(t *testing.T) {
+	body := "Title,Author,ISBN,ISBN13,Bookshelves\n" + `Dune,Frank Herbert,,,"a, b, read, c, d, e, f"` + "\n"
+
+	cr, err := newCSVBookReader(strings.NewReader(body), goodreadsCSVRecord("English"), "title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := readRows(t, cr)
+
+	want := []string{"a", "b", "c", "d", "e"}
+	if len(rows) != 1 || !reflect.DeepEqual(rows[0].book.Genres, want) {
+		t.Errorf("got genres %q; want %q", rows[0].book.Genres, want)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"Books/internal/data"
 	"Books/internal/validator"
 	"encoding/json"
 	"errors"
@@ -9,12 +10,68 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"reflect"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type envelope map[string]any
 
+// resource is a single JSON object in an envelope that has been cut down to a
+// sparse fieldset, or had related resources embedded into it.
+type resource map[string]any
+
+// newResource turns value, a struct or a pointer to one, into a resource with
+// the JSON fields named in fields. An empty fields keeps every field that
+// encoding/json would write.
+func newResource(value any, fields []string) resource {
+	v := reflect.Indirect(reflect.ValueOf(value))
+	t := v.Type()
+
+	res := resource{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+
+		if len(fields) > 0 {
+			if !validator.PermittedValue(name, fields...) {
+				continue
+			}
+		} else if strings.Contains(options, "omitempty") && isEmptyValue(v.Field(i)) {
+			continue
+		}
+		res[name] = v.Field(i).Interface()
+	}
+	return res
+}
+
+func newResources[T any](values []T, fields []string) []resource {
+	resources := make([]resource, len(values))
+	for i, value := range values {
+		resources[i] = newResource(value, fields)
+	}
+	return resources
+}
+
+// isEmptyValue reports whether encoding/json treats v as empty for omitempty.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
+
 func (app *application) readIDParam(r *http.Request) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
 	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
@@ -24,6 +81,24 @@ func (app *application) readIDParam(r *http.Request) (int64, error) {
 	return id, nil
 }
 
+func (app *application) readVersionParam(r *http.Request) (int32, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	version, err := strconv.ParseInt(params.ByName("version"), 10, 32)
+	if err != nil || version < 1 {
+		return 0, errors.New("invalid version parameter")
+	}
+	return int32(version), nil
+}
+
+func (app *application) readReviewIDParam(r *http.Request) (int64, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.ParseInt(params.ByName("review"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid review parameter")
+	}
+	return id, nil
+}
+
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
 	js, err := json.MarshalIndent(data, "", "\t")
 	if err != nil {
@@ -84,6 +159,62 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 	return nil
 }
 
+// bookETag derives a strong entity tag from the id and version of a book,
+// which change whenever an edit does, and from its rating, which reviews
+// change without bumping the version.
+func bookETag(book *data.Book) string {
+	return fmt.Sprintf(`"%d-%d-%d-%g"`, book.ID, book.Version, book.RatingCount, book.Rating)
+}
+
+// sparseBookETag derives a weak entity tag for a book cut down to fields or
+// embedding include. Weak, since it doesn't stand for the full book and so
+// can't be used in If-Match. Reviews change without touching the book, so
+// the latest update of the embedded ones is part of the tag too.
+func sparseBookETag(book *data.Book, fields, include []string, reviews []*data.Review) string {
+	var updated int64
+	for _, review := range reviews {
+		if t := review.UpdatedAt.Unix(); t > updated {
+			updated = t
+		}
+	}
+	return fmt.Sprintf(`W/"%d-%d-%d-%g-%s-%s-%d"`, book.ID, book.Version, book.RatingCount, book.Rating,
+		strings.Join(fields, "+"), strings.Join(include, "+"), updated)
+}
+
+// etagMatches reports whether etag is one of the entity tags listed in an
+// If-Match or If-None-Match header value. Weak tags only match when weak
+// comparison is allowed, as it is for If-None-Match.
+func etagMatches(header, etag string, weak bool) bool {
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag && !strings.HasPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch sends a 412 response and returns false when the request has
+// an If-Match header that doesn't match the current version of the book.
+func (app *application) checkIfMatch(w http.ResponseWriter, r *http.Request, book *data.Book) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch != "" && !etagMatches(ifMatch, bookETag(book), false) {
+		app.preconditionFailedResponse(w, r)
+		return false
+	}
+	return true
+}
+
 func (app *application) readString(qs url.Values, key string, defaultValue string) string {
 	s := qs.Get(key)
 	if s == "" {
@@ -100,6 +231,20 @@ func (app *application) readCSV(qs url.Values, key string, defaultValue []string
 	return strings.Split(csv, ",")
 }
 
+// readFields reads a comma-separated list such as a sparse fieldset, checking
+// that it only names permitted values and names each of them once.
+func (app *application) readFields(qs url.Values, key string, permitted []string, v *validator.Validator) []string {
+	fields := app.readCSV(qs, key, []string{})
+	for _, field := range fields {
+		if !validator.PermittedValue(field, permitted...) {
+			v.AddError(key, fmt.Sprintf("must only contain %s", strings.Join(permitted, ", ")))
+			break
+		}
+	}
+	v.Check(validator.Unique(fields), key, "must not contain duplicate values")
+	return fields
+}
+
 func (app *application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
 	s := qs.Get(key)
 	if s == "" {
@@ -113,9 +258,65 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+	return b
+}
+
+func (app *application) readFloat(qs url.Values, key string, defaultValue float64, v *validator.Validator) float64 {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		v.AddError(key, "must be a number")
+		return defaultValue
+	}
+	return f
+}
+
+// readTime accepts either an RFC 3339 timestamp or a plain date, which is
+// taken as midnight UTC.
+func (app *application) readTime(qs url.Values, key string, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t, err = time.Parse(time.DateOnly, s)
+	}
+	if err != nil {
+		v.AddError(key, "must be a date (2006-01-02) or an RFC 3339 timestamp")
+		return time.Time{}
+	}
+	return t
+}
+
+// extendDeadlines gives a request that streams a large body in or out longer
+// than the server timeouts allow other requests.
+func (app *application) extendDeadlines(w http.ResponseWriter, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(deadline)
+	_ = rc.SetWriteDeadline(deadline)
+}
+
 func (app *application) background(fn func()) {
 	app.wg.Add(1)
 	go func() {
+		defer app.wg.Done()
+
 		defer func() {
 			if err := recover(); err != nil {
 				app.logger.PrintError(fmt.Errorf("%s", err), nil)
@@ -124,3 +325,42 @@ func (app *application) background(fn func()) {
 		fn()
 	}()
 }
+
+// readShelfParam reads the name of a shelf from the URL. httprouter unescapes
+// the path, so names with spaces in them arrive as they were created.
+func (app *application) readShelfParam(r *http.Request) string {
+	params := httprouter.ParamsFromContext(r.Context())
+	return params.ByName("shelf")
+}
+
+func (app *application) readBookParam(r *http.Request) (int64, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.ParseInt(params.ByName("book"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid book parameter")
+	}
+	return id, nil
+}
+
+func (app *application) readYearParam(r *http.Request) (int, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	year, err := strconv.Atoi(params.ByName("year"))
+	if err != nil || year < 1 {
+		return 0, errors.New("invalid year parameter")
+	}
+	return year, nil
+}
+
+// parseDate parses a calendar date from a request body. An empty string
+// clears the date, so it comes back as nil.
+func (app *application) parseDate(s string, key string, v *validator.Validator) *time.Time {
+	if s == "" {
+		return nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		v.AddError(key, "must be a date (2006-01-02)")
+		return nil
+	}
+	return &t
+}
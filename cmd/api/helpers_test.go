@@ -0,0 +1,119 @@
+package main
+
+import (
+	"Books/internal/data"
+	"testing"
+	"time"
+)
+
+func TestBookETag(t *testing.T) {
+	book := &data.Book{ID: 7, Version: 3, RatingCount: 2, Rating: 4.5}
+	if got, want := bookETag(book), `"7-3-2-4.5"`; got != want {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	book.RatingCount, book.Rating = 3, 4
+	if got, want := bookETag(book), `"7-3-3-4"`; got != want {
+		t.Errorf("got %s after a review; want %s", got, want)
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		etag   string
+		weak   bool
+		want   bool
+	}{
+		{"empty header", "", `"1-1"`, true, false},
+		{"exact", `"1-1"`, `"1-1"`, false, true},
+		{"different", `"1-2"`, `"1-1"`, false, false},
+		{"unquoted", `1-1`, `"1-1"`, false, false},
+		{"wildcard", `*`, `"1-1"`, false, true},
+		{"one of a list", `"1-2", "1-1"`, `"1-1"`, false, true},
+		{"list without spaces", `"1-2","1-1"`, `"1-1"`, true, true},
+		{"weak candidate, weak comparison", `W/"1-1"`, `"1-1"`, true, true},
+		{"weak candidate, strong comparison", `W/"1-1"`, `"1-1"`, false, false},
+		{"weak tag, weak comparison", `"1-1"`, `W/"1-1"`, true, true},
+		{"weak tag and candidate, weak comparison", `W/"1-1"`, `W/"1-1"`, true, true},
+		{"weak tag, strong comparison", `W/"1-1"`, `W/"1-1"`, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := etagMatches(tt.header, tt.etag, tt.weak); got != tt.want {
+				t.Errorf("etagMatches(%q, %q, %t) = %t; want %t", tt.header, tt.etag, tt.weak, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewResource(t *testing.T) {
+	book := &data.Book{ID: 7, Title: "Dune", Pages: 412, Version: 3}
+
+	tests := []struct {
+		name   string
+		value  any
+		fields []string
+		want   []string
+	}{
+		{"all fields", book, nil, []string{"id", "title", "authors", "rating", "rating_count", "ISBN", "ISBN13", "pages", "version"}},
+		{"struct value", *book, nil, []string{"id", "title", "authors", "rating", "rating_count", "ISBN", "ISBN13", "pages", "version"}},
+		{"sparse", book, []string{"id", "title"}, []string{"id", "title"}},
+		{"sparse keeps empty fields", book, []string{"description", "genres"}, []string{"description", "genres"}},
+		{"hidden fields", book, []string{"CreatedAt", "title"}, []string{"title"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := newResource(tt.value, tt.fields)
+
+			if len(res) != len(tt.want) {
+				t.Errorf("got fields %v; want %v", res, tt.want)
+			}
+			for _, name := range tt.want {
+				if _, ok := res[name]; !ok {
+					t.Errorf("missing field %q in %v", name, res)
+				}
+			}
+		})
+	}
+
+	if res := newResource(book, []string{"title", "pages"}); res["title"] != "Dune" || res["pages"] != data.Pages(412) {
+		t.Errorf("got values %v", res)
+	}
+}
+
+func TestSparseBookETag(t *testing.T) {
+	book := &data.Book{ID: 7, Version: 3, RatingCount: 1, Rating: 5}
+	review := &data.Review{UpdatedAt: time.Unix(1700000000, 0)}
+
+	tests := []struct {
+		name    string
+		fields  []string
+		include []string
+		reviews []*data.Review
+		want    string
+	}{
+		{"fields", []string{"id", "title"}, nil, nil, `W/"7-3-1-5-id+title--0"`},
+		{"other fields", []string{"title"}, nil, nil, `W/"7-3-1-5-title--0"`},
+		{"include", nil, []string{"authors"}, nil, `W/"7-3-1-5--authors-0"`},
+		{"reviews", nil, []string{"reviews"}, []*data.Review{review}, `W/"7-3-1-5--reviews-1700000000"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sparseBookETag(book, tt.fields, tt.include, tt.reviews)
+			if got != tt.want {
+				t.Errorf("got %s; want %s", got, tt.want)
+			}
+			if etagMatches(got, got, false) {
+				t.Errorf("weak tag %s matched a strong comparison", got)
+			}
+			if !etagMatches(got, got, true) {
+				t.Errorf("tag %s didn't match itself", got)
+			}
+		})
+	}
+}
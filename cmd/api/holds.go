@@ -0,0 +1,172 @@
+package main
+
+import (
+	"Books/internal/data"
+	"Books/internal/validator"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// notifyHoldReady emails the user of a hold that has just become ready to
+// come and pick up their copy.
+func (app *application) notifyHoldReady(hold *data.ReadyHold) {
+	app.background(func() {
+		data := map[string]any{
+			"name":      hold.Name,
+			"title":     hold.Title,
+			"barcode":   hold.Barcode,
+			"expiresAt": hold.ExpiresAt.UTC().Format(time.RFC1123),
+		}
+		err := app.mailer.Send(hold.Email, "hold_ready.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+}
+
+// createHoldHandler puts the current user in the queue for a book. Holds can
+// only be placed while every copy of the book is out.
+func (app *application) createHoldHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Books.Get(bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	hold := &data.Hold{
+		BookID: bookID,
+		UserID: app.contextGetUser(r).ID,
+	}
+
+	v := validator.New()
+
+	err = app.models.Holds.Insert(hold)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrNoCopies):
+			v.AddError("book", "has no copies in the library")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrCopyAvailable):
+			v.AddError("book", "has a copy available to borrow")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateHold):
+			v.AddError("book", "you already have a hold on this book")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/holds/%d", hold.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"hold": hold}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getOwnHold fetches the hold in the URL for its user. It writes the error
+// response and returns nil when there is no such hold or it belongs to
+// somebody else.
+func (app *application) getOwnHold(w http.ResponseWriter, r *http.Request) *data.Hold {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	hold, err := app.models.Holds.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	if hold.UserID != app.contextGetUser(r).ID {
+		app.notPermittedResponse(w, r)
+		return nil
+	}
+	return hold
+}
+
+func (app *application) showHoldHandler(w http.ResponseWriter, r *http.Request) {
+	hold := app.getOwnHold(w, r)
+	if hold == nil {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"hold": hold}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// cancelHoldHandler takes a hold out of the queue. If a copy was being kept
+// for it, the copy goes to the next hold in the queue.
+func (app *application) cancelHoldHandler(w http.ResponseWriter, r *http.Request) {
+	hold := app.getOwnHold(w, r)
+	if hold == nil {
+		return
+	}
+
+	if hold.Status != data.HoldWaiting && hold.Status != data.HoldReady {
+		v := validator.New()
+		v.AddError("hold", fmt.Sprintf("is already %s", hold.Status))
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	next, err := app.models.Holds.Cancel(hold, app.config.holds.pickupWindow)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if next != nil {
+		app.notifyHoldReady(next)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"hold": hold}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listUserHoldsHandler(w http.ResponseWriter, r *http.Request) {
+	holds, err := app.models.Holds.GetActiveForUser(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"holds": holds}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
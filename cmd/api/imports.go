@@ -0,0 +1,459 @@
+package main
+
+import (
+	"Books/internal/data"
+	"Books/internal/validator"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// importRow is one book read from an import, with any errors found while
+// parsing it. Imports that fill shelves also carry the shelf the importing
+// user keeps the book on and their own rating of it.
+type importRow struct {
+	line     int
+	book     *data.Book
+	v        *validator.Validator
+	shelf    string
+	myRating int
+}
+
+// bookReader reads the books of an import one row at a time. Rows that
+// cannot be parsed are returned with errors; any other error ends the import.
+// Read returns io.EOF after the last row.
+type bookReader interface {
+	Read() (*importRow, error)
+}
+
+// csvRecord is a CSV row whose fields are looked up by the lower-cased name
+// of their column in the header row.
+type csvRecord struct {
+	header map[string]int
+	fields []string
+}
+
+func (rec csvRecord) get(column string) string {
+	i, ok := rec.header[column]
+	if !ok || i >= len(rec.fields) {
+		return ""
+	}
+	return strings.TrimSpace(rec.fields[i])
+}
+
+// csvRowMapper fills in row from a CSV record, recording the fields it
+// cannot parse in row.v.
+type csvRowMapper func(rec csvRecord, row *importRow)
+
+type csvBookReader struct {
+	r      *csv.Reader
+	header map[string]int
+	mapRow csvRowMapper
+}
+
+// newCSVBookReader reads the header row of r and checks that it has all of
+// the required columns.
+func newCSVBookReader(r io.Reader, mapRow csvRowMapper, required ...string) (*csvBookReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	record, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("body must contain a CSV header row")
+		}
+		return nil, err
+	}
+
+	header := make(map[string]int, len(record))
+	for i, column := range record {
+		header[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+
+	for _, column := range required {
+		if _, ok := header[column]; !ok {
+			return nil, fmt.Errorf("CSV header must contain a %q column", column)
+		}
+	}
+
+	return &csvBookReader{r: cr, header: header, mapRow: mapRow}, nil
+}
+
+func (cr *csvBookReader) Read() (*importRow, error) {
+	record, err := cr.r.Read()
+	if err != nil {
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			row := &importRow{line: parseError.StartLine, v: validator.New()}
+			row.v.AddError("row", parseError.Err.Error())
+			return row, nil
+		}
+		return nil, err
+	}
+
+	line, _ := cr.r.FieldPos(0)
+	row := &importRow{line: line, v: validator.New()}
+	cr.mapRow(csvRecord{header: cr.header, fields: record}, row)
+	return row, nil
+}
+
+// bookCSVRecord maps the columns of our own CSV format, named like the JSON
+// fields of a book. Authors and genres are comma-separated lists, and pages a
+// plain number.
+func bookCSVRecord(rec csvRecord, row *importRow) {
+	book := &data.Book{
+		Title:       rec.get("title"),
+		ISBN:        validator.NormalizeISBN(rec.get("isbn")),
+		ISBN13:      validator.NormalizeISBN(rec.get("isbn13")),
+		Language:    rec.get("language"),
+		Description: rec.get("description"),
+		Genres:      splitList(rec.get("genres")),
+	}
+
+	for _, name := range splitList(rec.get("authors")) {
+		book.Authors = append(book.Authors, data.BookAuthor{Name: name})
+	}
+
+	// An imported rating stands in for the rating of the book until it gets
+	// its first review.
+	if s := rec.get("rating"); s != "" {
+		rating, err := strconv.ParseFloat(s, 64)
+		row.v.Check(err == nil && rating >= 0 && rating <= 5, "rating", "must be a number between 0 and 5")
+		book.Rating = rating
+	}
+
+	if s := rec.get("pages"); s != "" {
+		pages, err := strconv.ParseInt(s, 10, 32)
+		row.v.Check(err == nil, "pages", "must be an integer value")
+		book.Pages = data.Pages(pages)
+	}
+	row.book = book
+}
+
+// splitList splits a comma-separated list, dropping blank entries. It
+// returns nil for an empty list.
+func splitList(s string) []string {
+	var values []string
+	for _, value := range strings.Split(s, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// ndjsonBookReader reads one bookInput per line, the same JSON that
+// createBookHandler accepts.
+type ndjsonBookReader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+func newNDJSONBookReader(r io.Reader) *ndjsonBookReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 1_048_576)
+	return &ndjsonBookReader{s: s}
+}
+
+func (nr *ndjsonBookReader) Read() (*importRow, error) {
+	for nr.s.Scan() {
+		nr.line++
+
+		line := bytes.TrimSpace(nr.s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		row := &importRow{line: nr.line, v: validator.New()}
+
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+
+		var input bookInput
+		if err := dec.Decode(&input); err != nil {
+			row.v.AddError("row", err.Error())
+			return row, nil
+		}
+		row.book = input.book()
+		return row, nil
+	}
+
+	if err := nr.s.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, fmt.Errorf("line %d is longer than 1MB", nr.line+1)
+		}
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+type importError struct {
+	Line   int               `json:"line"`
+	Errors map[string]string `json:"errors"`
+}
+
+// importReport sums up an import. In a dry run Imported counts the rows that
+// would have been imported. Existing counts the rows matched to a book that
+// was already there, in imports that deduplicate rather than reject them.
+type importReport struct {
+	DryRun   bool          `json:"dry_run"`
+	Rows     int           `json:"rows"`
+	Imported int           `json:"imported"`
+	Existing int           `json:"existing,omitempty"`
+	Rejected int           `json:"rejected"`
+	Errors   []importError `json:"errors"`
+}
+
+// bookImporter validates the rows of an import and inserts the valid ones in
+// batches, one transaction per batch.
+//
+// With dedupe set, rows whose ISBN-13 belongs to an existing book are matched
+// to that book instead of being rejected, and with matchOnly set as well, rows
+// that don't match an existing book are rejected instead of being inserted.
+// With shelve set, each imported or matched row that names a shelf puts its
+// book on that shelf of the importing user.
+type bookImporter struct {
+	app       *application
+	userID    int64
+	batchSize int
+	dedupe    bool
+	matchOnly bool
+	shelve    bool
+	report    importReport
+	batch     []*importRow
+	seen      map[string]int
+}
+
+func (app *application) newBookImporter(userID int64, dryRun bool) *bookImporter {
+	return &bookImporter{
+		app:       app,
+		userID:    userID,
+		batchSize: app.config.imports.batchSize,
+		report:    importReport{DryRun: dryRun, Errors: []importError{}},
+		seen:      map[string]int{},
+	}
+}
+
+// add queues row for insertion, flushing the batch once it is full. Rows that
+// could not be parsed, or that repeat the ISBN-13 of an earlier row, are
+// rejected right away.
+func (imp *bookImporter) add(row *importRow) error {
+	imp.report.Rows++
+
+	if !row.v.Valid() {
+		if row.book != nil {
+			data.ValidateBook(row.v, row.book)
+		}
+		imp.reject(row)
+		return nil
+	}
+
+	if row.book.ISBN13 != "" {
+		if line, ok := imp.seen[row.book.ISBN13]; ok {
+			row.v.AddError("ISBN13", fmt.Sprintf("duplicates the book on line %d", line))
+			imp.reject(row)
+			return nil
+		}
+		imp.seen[row.book.ISBN13] = row.line
+	}
+
+	imp.batch = append(imp.batch, row)
+	if len(imp.batch) >= imp.batchSize {
+		return imp.flush()
+	}
+	return nil
+}
+
+// flush validates and inserts the queued rows, or in a dry run only checks
+// them against the books that already exist.
+func (imp *bookImporter) flush() error {
+	if len(imp.batch) == 0 {
+		return nil
+	}
+
+	isbns := make([]string, len(imp.batch))
+	for i, row := range imp.batch {
+		isbns[i] = row.book.ISBN13
+	}
+
+	existing, err := imp.app.models.Books.ExistingISBN13s(isbns)
+	if err != nil {
+		return err
+	}
+
+	var saved, rows []*importRow
+	var books []*data.Book
+	for _, row := range imp.batch {
+		if id, ok := existing[row.book.ISBN13]; ok {
+			if imp.dedupe {
+				row.book.ID = id
+				imp.report.Existing++
+				saved = append(saved, row)
+				continue
+			}
+			row.v.AddError("ISBN13", "a book with this ISBN13 already exists")
+		}
+
+		if imp.matchOnly {
+			row.v.AddError("ISBN13", "must belong to a book in the catalog")
+			imp.reject(row)
+			continue
+		}
+
+		if data.ValidateBook(row.v, row.book); !row.v.Valid() {
+			imp.reject(row)
+			continue
+		}
+		rows = append(rows, row)
+		books = append(books, row.book)
+	}
+	imp.batch = imp.batch[:0]
+
+	if imp.report.DryRun {
+		imp.report.Imported += len(books)
+		return nil
+	}
+
+	skipped, err := imp.app.models.Books.InsertBatch(books, imp.userID)
+	if err != nil {
+		return err
+	}
+
+	for i, row := range rows {
+		switch {
+		case skipped[i] == nil:
+			imp.report.Imported++
+			saved = append(saved, row)
+			continue
+		case errors.Is(skipped[i], data.ErrUnknownAuthor):
+			row.v.AddError("authors", "must only reference existing author ids")
+		case errors.Is(skipped[i], data.ErrDuplicateISBN):
+			row.v.AddError("ISBN13", "a book with this ISBN13 already exists")
+		}
+		imp.reject(row)
+	}
+
+	return imp.shelveRows(saved)
+}
+
+// shelveRows puts the books of the saved rows on the shelves they name.
+func (imp *bookImporter) shelveRows(rows []*importRow) error {
+	if !imp.shelve {
+		return nil
+	}
+
+	var entries []data.ShelfEntry
+	for _, row := range rows {
+		if row.shelf == "" {
+			continue
+		}
+		entries = append(entries, data.ShelfEntry{Shelf: row.shelf, BookID: row.book.ID, Rating: row.myRating})
+	}
+	return imp.app.models.Shelves.AddEntries(imp.userID, entries)
+}
+
+func (imp *bookImporter) reject(row *importRow) {
+	imp.report.Rejected++
+	imp.report.Errors = append(imp.report.Errors, importError{Line: row.line, Errors: row.v.Errors})
+}
+
+// run imports every row of br. A read error stops the import and is
+// returned as readErr; the batches flushed before it stay imported.
+func (imp *bookImporter) run(br bookReader) (readErr error, err error) {
+	for {
+		row, rerr := br.Read()
+		if errors.Is(rerr, io.EOF) {
+			break
+		}
+		if rerr != nil {
+			readErr = rerr
+			break
+		}
+
+		if err = imp.add(row); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = imp.flush(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(imp.report.Errors, func(i, j int) bool {
+		return imp.report.Errors[i].Line < imp.report.Errors[j].Line
+	})
+	return readErr, nil
+}
+
+// respond writes the import report, along with the error that cut the import
+// short if there was one.
+func (imp *bookImporter) respond(w http.ResponseWriter, r *http.Request, readErr error) {
+	status := http.StatusOK
+	env := envelope{"import": imp.report}
+
+	if readErr != nil {
+		status = http.StatusBadRequest
+		env["error"] = readErr.Error()
+
+		var maxBytesError *http.MaxBytesError
+		if errors.As(readErr, &maxBytesError) {
+			status = http.StatusRequestEntityTooLarge
+			env["error"] = fmt.Sprintf("body must not be larger than %d bytes", maxBytesError.Limit)
+		}
+	}
+
+	err := imp.app.writeJSON(w, status, env, nil)
+	if err != nil {
+		imp.app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) importBooksHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	dryRun := app.readBool(r.URL.Query(), "dry_run", false, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	app.extendDeadlines(w, app.config.imports.timeout)
+	body := http.MaxBytesReader(w, r.Body, app.config.imports.maxBytes)
+
+	var br bookReader
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		cr, err := newCSVBookReader(body, bookCSVRecord, "title", "isbn13")
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		br = cr
+	case "application/x-ndjson", "application/ndjson":
+		br = newNDJSONBookReader(body)
+	default:
+		app.unsupportedMediaTypeResponse(w, r, "text/csv", "application/x-ndjson")
+		return
+	}
+
+	imp := app.newBookImporter(app.contextGetUser(r).ID, dryRun)
+
+	readErr, err := imp.run(br)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	imp.respond(w, r, readErr)
+}
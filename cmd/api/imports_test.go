@@ -0,0 +1,172 @@
+package main
+
+import (
+	"Books/internal/data"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readRows reads every row of br, failing the test on anything but io.EOF.
+func readRows(t *testing.T, br bookReader) []*importRow {
+	t.Helper()
+
+	var rows []*importRow
+	for {
+		row, err := br.Read()
+		if errors.Is(err, io.EOF) {
+			return rows
+		}
+		if err != nil {
+			t.Fatalf("Read returned error: %v", err)
+		}
+		rows = append(rows, row)
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"", nil},
+		{" , ,", nil},
+		{"fantasy", []string{"fantasy"}},
+		{"fantasy, science fiction ,,classics", []string{"fantasy", "science fiction", "classics"}},
+	}
+
+	for _, tt := range tests {
+		if got := splitList(tt.s); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitList(%q) = %q; want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestNewCSVBookReaderHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"all columns", "Title,ISBN13\n", ""},
+		{"case and spaces", " title , Isbn13 \n", ""},
+		{"missing column", "title\n", `CSV header must contain a "isbn13" column`},
+		{"empty", "", "body must contain a CSV header row"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newCSVBookReader(strings.NewReader(tt.body), bookCSVRecord, "title", "isbn13")
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("got error %v", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Errorf("got error %v; want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBookCSVRecord(t *testing.T) {
+	body := "title,authors,isbn,isbn13,language,description,genres,pages,rating\n" +
+		`Dune,"Frank Herbert",0-441-01359-7,978-0-441-01359-3,English,Spice,"science fiction, classics",412,4.25` + "\n" +
+		`Untitled,,,,,,,many,7` + "\n" +
+		`"Broken,quote` + "\n"
+
+	cr, err := newCSVBookReader(strings.NewReader(body), bookCSVRecord, "title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := readRows(t, cr)
+
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows; want 3", len(rows))
+	}
+
+	want := &data.Book{
+		Title:       "Dune",
+		Authors:     data.BookAuthors{{Name: "Frank Herbert"}},
+		ISBN:        "0441013597",
+		ISBN13:      "9780441013593",
+		Language:    "English",
+		Description: "Spice",
+		Genres:      []string{"science fiction", "classics"},
+		Pages:       412,
+		Rating:      4.25,
+	}
+	if !rows[0].v.Valid() || !reflect.DeepEqual(rows[0].book, want) {
+		t.Errorf("got %+v with errors %v; want %+v", rows[0].book, rows[0].v.Errors, want)
+	}
+	if rows[0].line != 2 {
+		t.Errorf("got line %d; want 2", rows[0].line)
+	}
+
+	if got := rows[1].v.Errors["pages"]; got != "must be an integer value" {
+		t.Errorf("got pages error %q", got)
+	}
+	if got := rows[1].v.Errors["rating"]; got != "must be a number between 0 and 5" {
+		t.Errorf("got rating error %q", got)
+	}
+	if rows[1].book == nil || rows[1].book.Genres != nil {
+		t.Errorf("got %+v for a row without genres", rows[1].book)
+	}
+
+	if rows[2].book != nil || rows[2].v.Errors["row"] == "" {
+		t.Errorf("got %+v with errors %v for a malformed row", rows[2].book, rows[2].v.Errors)
+	}
+}
+
+func TestNDJSONBookReader(t *testing.T) {
+	body := `{"title":"Dune","authors":[{"name":"Frank Herbert"}],"ISBN13":"978-0-441-01359-3","genres":["classics"],"pages":"412 pages"}` + "\n" +
+		"\n" +
+		`{"title":"Dune","colour":"orange"}` + "\n" +
+		`{"title":` + "\n"
+
+	rows := readRows(t, newNDJSONBookReader(strings.NewReader(body)))
+
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows; want 3", len(rows))
+	}
+
+	want := &data.Book{
+		Title:   "Dune",
+		Authors: data.BookAuthors{{Name: "Frank Herbert"}},
+		ISBN13:  "9780441013593",
+		Genres:  []string{"classics"},
+		Pages:   412,
+	}
+	if !rows[0].v.Valid() || !reflect.DeepEqual(rows[0].book, want) {
+		t.Errorf("got %+v with errors %v; want %+v", rows[0].book, rows[0].v.Errors, want)
+	}
+
+	tests := []struct {
+		row  *importRow
+		line int
+	}{
+		{rows[1], 3},
+		{rows[2], 4},
+	}
+	for _, tt := range tests {
+		if tt.row.line != tt.line {
+			t.Errorf("got line %d; want %d", tt.row.line, tt.line)
+		}
+		if tt.row.book != nil || tt.row.v.Errors["row"] == "" {
+			t.Errorf("line %d: got %+v with errors %v", tt.line, tt.row.book, tt.row.v.Errors)
+		}
+	}
+}
+
+func TestNDJSONBookReaderLongLine(t *testing.T) {
+	body := "{}\n" + strings.Repeat("x", 1_048_577) + "\n"
+	nr := newNDJSONBookReader(strings.NewReader(body))
+
+	if _, err := nr.Read(); err != nil {
+		t.Fatalf("first Read returned error: %v", err)
+	}
+	_, err := nr.Read()
+	if err == nil || err.Error() != "line 2 is longer than 1MB" {
+		t.Errorf("got error %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"Books/internal/data"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// schedule runs fn every interval for the lifetime of the process. A panic
+// in one run is logged and doesn't stop the following runs.
+func (app *application) schedule(interval time.Duration, fn func()) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			func() {
+				defer func() {
+					if err := recover(); err != nil {
+						app.logger.PrintError(fmt.Errorf("%s", err), nil)
+					}
+				}()
+				fn()
+			}()
+		}
+	}()
+}
+
+// startTrashPurger starts purging the books that have been in the trash for
+// longer than the retention period, every purge interval.
+func (app *application) startTrashPurger() {
+	app.schedule(app.config.trash.purgeInterval, func() {
+		purged, err := app.models.Books.PurgeDeletedBefore(time.Now().Add(-app.config.trash.retention))
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return
+		}
+		if purged > 0 {
+			app.logger.PrintInfo("purged books from trash", map[string]string{
+				"count": strconv.FormatInt(purged, 10),
+			})
+		}
+	})
+}
+
+// overdueReminderBatch is how many overdue reminders are sent per run of
+// the overdue reminder. Whatever is left over goes out on the next run.
+const overdueReminderBatch = 100
+
+// startOverdueReminder starts emailing the borrowers of overdue loans, every
+// reminder check interval.
+func (app *application) startOverdueReminder() {
+	app.schedule(app.config.loans.reminderCheck, func() {
+		loans, err := app.models.Loans.GetDueReminders(app.config.loans.reminderInterval, overdueReminderBatch)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return
+		}
+
+		sent := 0
+		for _, loan := range loans {
+			data := map[string]any{
+				"name":        loan.Name,
+				"title":       loan.Title,
+				"barcode":     loan.Barcode,
+				"dueDate":     loan.DueAt.Format(time.DateOnly),
+				"daysOverdue": int(time.Since(loan.DueAt).Hours()/24) + 1,
+			}
+
+			err = app.mailer.Send(loan.Email, "loan_overdue.tmpl", data)
+			if err != nil {
+				app.logger.PrintError(err, map[string]string{"loan_id": strconv.FormatInt(loan.ID, 10)})
+				continue
+			}
+
+			err = app.models.Loans.MarkReminded(loan.ID)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+				return
+			}
+			sent++
+		}
+
+		if sent > 0 {
+			app.logger.PrintInfo("sent overdue loan reminders", map[string]string{
+				"count": strconv.Itoa(sent),
+			})
+		}
+	})
+}
+
+// holdExpiryBatch is how many uncollected holds are expired per run of the
+// hold expirer.
+const holdExpiryBatch = 100
+
+// startHoldExpirer starts ending the ready holds nobody came to pick up,
+// passing each copy on to the next hold in the queue for its book, every
+// expiry check interval.
+func (app *application) startHoldExpirer() {
+	app.schedule(app.config.holds.expiryCheck, func() {
+		holds, err := app.models.Holds.GetExpired(holdExpiryBatch)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return
+		}
+
+		expired := 0
+		for _, hold := range holds {
+			next, err := app.models.Holds.Expire(hold, app.config.holds.pickupWindow)
+			if err != nil {
+				// The copy was collected or the hold cancelled since it was
+				// fetched, so there's nothing to expire.
+				if errors.Is(err, data.ErrEditConflict) {
+					continue
+				}
+				app.logger.PrintError(err, map[string]string{"hold_id": strconv.FormatInt(hold.ID, 10)})
+				continue
+			}
+			expired++
+
+			if next != nil {
+				app.notifyHoldReady(next)
+			}
+		}
+
+		if expired > 0 {
+			app.logger.PrintInfo("expired uncollected holds", map[string]string{
+				"count": strconv.Itoa(expired),
+			})
+		}
+	})
+}
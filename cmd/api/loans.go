@@ -0,0 +1,268 @@
+package main
+
+import (
+	"Books/internal/data"
+	"Books/internal/validator"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// checkoutHandler lends the copy with the given barcode to the user with the
+// given email address, due back after the loan period.
+func (app *application) checkoutHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Barcode string `json:"barcode"`
+		Email   string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Barcode != "", "barcode", "must be provided")
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	bookCopy, err := app.models.Copies.GetByBarcode(input.Barcode)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("barcode", "no copy with this barcode was found")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("email", "no user with this email address was found")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	loan := &data.Loan{
+		CopyID: bookCopy.ID,
+		BookID: bookCopy.BookID,
+		UserID: user.ID,
+		DueAt:  time.Now().Add(app.config.loans.period),
+	}
+
+	err = app.models.Loans.Checkout(loan)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrCopyOnLoan):
+			app.copyOnLoanResponse(w, r)
+		case errors.Is(err, data.ErrCopyOnHold):
+			app.copyOnHoldResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/loans/%d", loan.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"loan": loan}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getLoan fetches the loan in the URL. It writes the error response and
+// returns nil when there is no such loan.
+func (app *application) getLoan(w http.ResponseWriter, r *http.Request) *data.Loan {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	loan, err := app.models.Loans.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+	return loan
+}
+
+func (app *application) showLoanHandler(w http.ResponseWriter, r *http.Request) {
+	loan := app.getLoan(w, r)
+	if loan == nil {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"loan": loan}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) returnLoanHandler(w http.ResponseWriter, r *http.Request) {
+	loan := app.getLoan(w, r)
+	if loan == nil {
+		return
+	}
+
+	if loan.ReturnedAt != nil {
+		v := validator.New()
+		v.AddError("loan", "has already been returned")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	hold, err := app.models.Loans.Return(loan, app.config.holds.pickupWindow)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if hold != nil {
+		app.notifyHoldReady(hold)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"loan": loan}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// renewLoanHandler extends an active loan by another loan period, counted
+// from the due date or from now if the loan is overdue. Borrowers can renew
+// their own loans; anybody else needs the loans:write permission.
+func (app *application) renewLoanHandler(w http.ResponseWriter, r *http.Request) {
+	loan := app.getLoan(w, r)
+	if loan == nil {
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if loan.UserID != user.ID {
+		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !permissions.Include("loans:write") {
+			app.notPermittedResponse(w, r)
+			return
+		}
+	}
+
+	v := validator.New()
+	v.Check(loan.ReturnedAt == nil, "loan", "has already been returned")
+	v.Check(loan.Renewals < app.config.loans.maxRenewals, "loan", fmt.Sprintf("must not be renewed more than %d times", app.config.loans.maxRenewals))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	from := loan.DueAt
+	if now := time.Now(); now.After(from) {
+		from = now
+	}
+
+	err := app.models.Loans.Renew(loan, from.Add(app.config.loans.period))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"loan": loan}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listOverdueLoansHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = "due_at"
+	input.Filters.SortSafelist = []string{"due_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	loans, metadata, err := app.models.Loans.GetOverdue(input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"loans": loans, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listUserLoansHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Active bool
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Active = app.readBool(qs, "active", false, v)
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-checked_out_at")
+	input.Filters.SortSafelist = []string{"checked_out_at", "due_at", "-checked_out_at", "-due_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	loans, metadata, err := app.models.Loans.GetAllForUser(app.contextGetUser(r).ID, input.Active, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"loans": loans, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"Books/internal/data"
 	"Books/internal/jsonlog"
+	"Books/internal/lru"
 	"Books/internal/mailer"
 	"context"
 	"database/sql"
@@ -28,9 +29,11 @@ type config struct {
 		maxIdleTime  string
 	}
 	limiter struct {
-		rps     float64
-		burst   int
-		enabled bool
+		rps          float64
+		burst        int
+		enabled      bool
+		suggestRps   float64
+		suggestBurst int
 	}
 	smtp struct {
 		host     string
@@ -39,24 +42,50 @@ type config struct {
 		password string
 		sender   string
 	}
+	trash struct {
+		retention     time.Duration
+		purgeInterval time.Duration
+	}
+	suggest struct {
+		cacheSize int
+		cacheTTL  time.Duration
+	}
+	imports struct {
+		maxBytes  int64
+		batchSize int
+		timeout   time.Duration
+	}
+	exports struct {
+		timeout time.Duration
+	}
+	loans struct {
+		period           time.Duration
+		maxRenewals      int
+		reminderInterval time.Duration
+		reminderCheck    time.Duration
+	}
+	holds struct {
+		pickupWindow time.Duration
+		expiryCheck  time.Duration
+	}
 }
 
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config       config
+	logger       *jsonlog.Logger
+	models       data.Models
+	mailer       mailer.Mailer
+	suggestCache *lru.Cache[string, []data.Completion]
+	wg           sync.WaitGroup
 }
 
-func init() {
+func main() {
+	// Loaded here rather than in init, so that the tests of this package can
+	// run without a .env file.
 	err := godotenv.Load()
 	if err != nil {
 		log.Fatal("Error loading .env file")
 	}
-}
-
-func main() {
 
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 	var cfg config
@@ -72,6 +101,8 @@ func main() {
 	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	flag.Float64Var(&cfg.limiter.suggestRps, "limiter-suggest-rps", 10, "Rate limiter maximum autocomplete requests per second")
+	flag.IntVar(&cfg.limiter.suggestBurst, "limiter-suggest-burst", 20, "Rate limiter maximum autocomplete burst")
 
 	port, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
 	flag.StringVar(&cfg.smtp.host, "smtp-host", os.Getenv("SMTP_HOST"), "SMTP host")
@@ -79,6 +110,26 @@ func main() {
 	flag.StringVar(&cfg.smtp.username, "smtp-username", os.Getenv("SMTP_USERNAME"), "SMTP username")
 	flag.StringVar(&cfg.smtp.password, "smtp-password", os.Getenv("SMTP_PASSWORD"), "SMTP password")
 	flag.StringVar(&cfg.smtp.sender, "smtp-sender", os.Getenv("SMTP_SENDER"), "SMTP sender")
+
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted books stay in the trash")
+	flag.DurationVar(&cfg.trash.purgeInterval, "trash-purge-interval", time.Hour, "How often expired books are purged from the trash")
+
+	flag.IntVar(&cfg.suggest.cacheSize, "suggest-cache-size", 1000, "Number of autocomplete results to cache (0 disables the cache)")
+	flag.DurationVar(&cfg.suggest.cacheTTL, "suggest-cache-ttl", time.Minute, "How long cached autocomplete results are served")
+
+	flag.Int64Var(&cfg.imports.maxBytes, "import-max-bytes", 100<<20, "Maximum size of a bulk import request body")
+	flag.IntVar(&cfg.imports.batchSize, "import-batch-size", 1000, "Number of books inserted per bulk import transaction")
+	flag.DurationVar(&cfg.imports.timeout, "import-timeout", 10*time.Minute, "How long a bulk import request may take")
+
+	flag.DurationVar(&cfg.exports.timeout, "export-timeout", 30*time.Minute, "How long a catalog export request may take")
+
+	flag.DurationVar(&cfg.loans.period, "loan-period", 21*24*time.Hour, "How long a copy is lent out for, and how long a renewal adds")
+	flag.IntVar(&cfg.loans.maxRenewals, "loan-max-renewals", 2, "How many times a loan may be renewed")
+	flag.DurationVar(&cfg.loans.reminderInterval, "loan-reminder-interval", 24*time.Hour, "How often borrowers are reminded about an overdue loan")
+	flag.DurationVar(&cfg.loans.reminderCheck, "loan-reminder-check", time.Hour, "How often overdue loans are checked for reminders to send")
+
+	flag.DurationVar(&cfg.holds.pickupWindow, "hold-pickup-window", 3*24*time.Hour, "How long a returned copy is kept for the next hold in the queue")
+	flag.DurationVar(&cfg.holds.expiryCheck, "hold-expiry-check", 15*time.Minute, "How often uncollected holds are checked for expiry")
 	flag.Parse()
 
 	db, err := openDB(cfg)
@@ -95,6 +146,14 @@ func main() {
 		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
 	}
 
+	if cfg.suggest.cacheSize > 0 {
+		app.suggestCache = lru.New[string, []data.Completion](cfg.suggest.cacheSize, cfg.suggest.cacheTTL)
+	}
+
+	app.startTrashPurger()
+	app.startOverdueReminder()
+	app.startHoldExpirer()
+
 	err = app.serve()
 	if err != nil {
 		logger.PrintFatal(err, nil)
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"Books/internal/data"
+	"Books/internal/validator"
+	"errors"
+	"net/http"
+	"time"
+)
+
+func (app *application) listProgressHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Finished *bool
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	if qs.Has("finished") {
+		finished := app.readBool(qs, "finished", false, v)
+		input.Finished = &finished
+	}
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-updated_at")
+	input.Filters.SortSafelist = []string{"updated_at", "started_at", "finished_at", "percent", "-updated_at", "-started_at", "-finished_at", "-percent"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	progress, metadata, err := app.models.Progress.GetAllForUser(app.contextGetUser(r).ID, input.Finished, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"progress": progress, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showProgressHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := app.readBookParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	progress, err := app.models.Progress.Get(app.contextGetUser(r).ID, bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"progress": progress}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateProgressHandler records progress on a book as either a page or a
+// percentage. A book is started today unless the client says otherwise, and
+// finished once it is read to the end. The book moves to the currently-reading
+// or read shelf of the user to match.
+func (app *application) updateProgressHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := app.readBookParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	book, err := app.models.Books.Get(bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	progress, err := app.models.Progress.Get(user.ID, bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			progress = &data.Progress{UserID: user.ID, BookID: bookID}
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	var input struct {
+		Page       *int32   `json:"page"`
+		Percent    *float64 `json:"percent"`
+		StartedAt  *string  `json:"started_at"`
+		FinishedAt *string  `json:"finished_at"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Page == nil || input.Percent == nil, "percent", "must not be provided together with page")
+
+	if input.Page != nil {
+		progress.SetPage(*input.Page, book.Pages)
+	}
+	if input.Percent != nil {
+		progress.SetPercent(*input.Percent)
+	}
+	if input.StartedAt != nil {
+		progress.StartedAt = app.parseDate(*input.StartedAt, "started_at", v)
+	}
+	if input.FinishedAt != nil {
+		progress.FinishedAt = app.parseDate(*input.FinishedAt, "finished_at", v)
+
+		// Saying when a book was finished means it was read to the end.
+		if progress.FinishedAt != nil {
+			if progress.Page != nil && book.Pages > 0 {
+				progress.SetPage(int32(book.Pages), book.Pages)
+			} else {
+				progress.SetPercent(100)
+			}
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	if progress.FinishedAt == nil && progress.Percent == 100 && input.FinishedAt == nil {
+		progress.FinishedAt = &today
+	}
+	if progress.StartedAt == nil {
+		progress.StartedAt = &today
+		if progress.FinishedAt != nil {
+			progress.StartedAt = progress.FinishedAt
+		}
+	}
+
+	if data.ValidateProgress(v, progress, book.Pages); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Progress.Save(progress)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	shelf := data.ShelfCurrentlyReading
+	if progress.FinishedAt != nil {
+		shelf = data.ShelfRead
+	}
+
+	err = app.models.Shelves.AddEntries(user.ID, []data.ShelfEntry{{Shelf: shelf, BookID: bookID}})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"progress": progress}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteProgressHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := app.readBookParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Progress.Delete(app.contextGetUser(r).ID, bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "progress successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -14,14 +14,96 @@ func (app *application) routes() http.Handler {
 
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
 
-	router.HandlerFunc(http.MethodPost, "/v1/books", app.createBookHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/books", app.listBooksHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/books/:id", app.showBookHandler)
-	router.HandlerFunc(http.MethodPatch, "/v1/books/:id", app.updateBookHandler)
-	router.HandlerFunc(http.MethodDelete, "/v1/books/:id", app.deleteBookHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/books", app.requirePermission("books:write", app.createBookHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/books", app.requirePermission("books:read", app.listBooksHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/books/:id", app.requirePermission("books:read", app.showBookHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/books/:id", app.requirePermission("books:write", app.updateBookHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/books/:id", app.requirePermission("books:write", app.deleteBookHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/books/:id/restore", app.requirePermission("books:write", app.restoreBookHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/books/:id/revisions", app.requirePermission("books:read", app.listBookRevisionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/books/:id/revisions/:version", app.requirePermission("books:read", app.showBookRevisionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/books/:id/revisions/:version/diff", app.requirePermission("books:read", app.diffBookRevisionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/books/:id/revisions/:version/revert", app.requirePermission("books:write", app.revertBookRevisionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/books/:id/reviews", app.requirePermission("books:read", app.listReviewsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/books/:id/reviews", app.requirePermission("books:read", app.createReviewHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/books/:id/reviews/:review", app.requirePermission("books:read", app.showReviewHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/books/:id/reviews/:review", app.requirePermission("books:read", app.updateReviewHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/books/:id/reviews/:review", app.requirePermission("books:read", app.deleteReviewHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/books/:id/copies", app.requirePermission("books:read", app.listCopiesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/books/:id/copies", app.requirePermission("loans:write", app.createCopyHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/books/:id/holds", app.requirePermission("books:read", app.createHoldHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/copies/:id", app.requirePermission("books:read", app.showCopyHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/copies/:id", app.requirePermission("loans:write", app.updateCopyHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/copies/:id", app.requirePermission("loans:write", app.deleteCopyHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/loans", app.requirePermission("loans:write", app.checkoutHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/loans/:id", app.requirePermission("loans:write", app.showLoanHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/loans/:id/return", app.requirePermission("loans:write", app.returnLoanHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/loans/:id/renew", app.requirePermission("books:read", app.renewLoanHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/holds/:id", app.requirePermission("books:read", app.showHoldHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/holds/:id", app.requirePermission("books:read", app.cancelHoldHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/authors", app.requirePermission("books:write", app.createAuthorHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/authors", app.requirePermission("books:read", app.listAuthorsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/authors/:id", app.requirePermission("books:read", app.showAuthorHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/authors/:id", app.requirePermission("books:write", app.updateAuthorHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/authors/:id", app.requirePermission("books:write", app.deleteAuthorHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/authors/:id/books", app.requirePermission("books:read", app.listAuthorBooksHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodGet, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/shelves", app.requirePermission("books:read", app.listShelvesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/shelves", app.requirePermission("books:read", app.createShelfHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me/shelves/:shelf", app.requirePermission("books:read", app.updateShelfHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/shelves/:shelf", app.requirePermission("books:read", app.deleteShelfHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/shelves/:shelf/books", app.requirePermission("books:read", app.listShelfBooksHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/shelves/:shelf/books/:book", app.requirePermission("books:read", app.addShelfBookHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/shelves/:shelf/books/:book", app.requirePermission("books:read", app.removeShelfBookHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/progress", app.requirePermission("books:read", app.listProgressHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/progress/:book", app.requirePermission("books:read", app.showProgressHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/progress/:book", app.requirePermission("books:read", app.updateProgressHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/progress/:book", app.requirePermission("books:read", app.deleteProgressHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/holds", app.requirePermission("books:read", app.listUserHoldsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/loans", app.requirePermission("books:read", app.listUserLoansHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/stats", app.requirePermission("books:read", app.showStatsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/goals/:year", app.requirePermission("books:read", app.showGoalHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/goals/:year", app.requirePermission("books:read", app.setGoalHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/goals/:year", app.requirePermission("books:read", app.deleteGoalHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.createActivationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
+
+	// httprouter doesn't allow a fixed path segment and a named parameter in the
+	// same position, so routes that would clash with /v1/books/:id are kept on
+	// a router of their own that is tried first and falls through to the main
+	// router when nothing matches.
+	staticRouter := httprouter.New()
+
+	staticRouter.NotFound = router
+	staticRouter.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
+
+	staticRouter.HandlerFunc(http.MethodGet, "/v1/books/isbn/:isbn", app.requirePermission("books:read", app.showBookByISBNHandler))
+	staticRouter.HandlerFunc(http.MethodGet, "/v1/books/trash", app.requirePermission("books:write", app.listTrashedBooksHandler))
+	staticRouter.HandlerFunc(http.MethodPost, "/v1/books/import", app.requirePermission("books:write", app.importBooksHandler))
+	staticRouter.HandlerFunc(http.MethodPost, "/v1/books/import/goodreads", app.requirePermission("books:read", app.importGoodreadsHandler))
+	staticRouter.HandlerFunc(http.MethodGet, "/v1/books/export", app.requirePermission("books:read", app.exportBooksHandler))
+	staticRouter.HandlerFunc(http.MethodDelete, "/v1/books/trash/:id", app.requirePermission("admin", app.purgeBookHandler))
+	staticRouter.HandlerFunc(http.MethodGet, "/v1/loans/overdue", app.requirePermission("loans:write", app.listOverdueLoansHandler))
+
+	// Every user is given books:read when they register, so autocomplete only
+	// checks that the user is activated and saves a permissions query on every
+	// keystroke.
+	staticRouter.HandlerFunc(http.MethodGet, "/v1/search/suggest", app.requireActivatedUser(app.suggestHandler))
+
+	// Autocomplete fires on every keystroke, so it gets a rate limit of its own
+	// instead of using up the budget of the rest of the API.
+	mux := http.NewServeMux()
+	mux.Handle("/v1/search/", app.limitRate(app.config.limiter.suggestRps, app.config.limiter.suggestBurst, app.authenticate(staticRouter)))
+	mux.Handle("/", app.rateLimit(app.authenticate(staticRouter)))
 
-	return app.recoverPanic(app.rateLimit(router))
+	return app.recoverPanic(mux)
 }
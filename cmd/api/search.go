@@ -0,0 +1,62 @@
+package main
+
+import (
+	"Books/internal/data"
+	"Books/internal/validator"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+func (app *application) suggestHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Prefix string
+		Type   string
+		Limit  int
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Prefix = app.readString(qs, "prefix", "")
+	input.Type = app.readString(qs, "type", data.CompletionTitle)
+	input.Limit = app.readInt(qs, "limit", 10, v)
+
+	v.Check(input.Prefix != "", "prefix", "must be provided")
+	v.Check(len(input.Prefix) <= 100, "prefix", "must not be more than 100 bytes long")
+	v.Check(input.Type != data.CompletionTitle || utf8.RuneCountInString(input.Prefix) >= data.MinTitlePrefixLength, "prefix", fmt.Sprintf("must be at least %d characters long for titles", data.MinTitlePrefixLength))
+	v.Check(validator.PermittedValue(input.Type, data.CompletionTypes...), "type", "must be one of title, author or genre")
+	v.Check(input.Limit > 0, "limit", "must be greater than zero")
+	v.Check(input.Limit <= 20, "limit", "must be a maximum of 20")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	key := fmt.Sprintf("%s|%d|%s", input.Type, input.Limit, strings.ToLower(input.Prefix))
+
+	var completions []data.Completion
+	var cached bool
+	if app.suggestCache != nil {
+		completions, cached = app.suggestCache.Get(key)
+	}
+
+	if !cached {
+		var err error
+		completions, err = app.models.Search.Complete(input.Type, input.Prefix, input.Limit)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if app.suggestCache != nil {
+			app.suggestCache.Add(key, completions)
+		}
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"suggestions": completions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
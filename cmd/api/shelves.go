@@ -0,0 +1,270 @@
+package main
+
+import (
+	"Books/internal/data"
+	"Books/internal/validator"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+func (app *application) listShelvesHandler(w http.ResponseWriter, r *http.Request) {
+	shelves, err := app.models.Shelves.GetAllForUser(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"shelves": shelves}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createShelfHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	shelf := &data.Shelf{Name: input.Name}
+
+	v := validator.New()
+	if data.ValidateShelf(v, shelf); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Shelves.Insert(app.contextGetUser(r).ID, shelf)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateShelf):
+			v.AddError("name", "a shelf with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/users/me/shelves/%s", url.PathEscape(shelf.Name)))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"shelf": shelf}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getShelf fetches the shelf in the URL from the shelves of the current user.
+// It writes the error response and returns nil when there is no such shelf.
+func (app *application) getShelf(w http.ResponseWriter, r *http.Request) *data.Shelf {
+	shelf, err := app.models.Shelves.GetForUser(app.contextGetUser(r).ID, app.readShelfParam(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+	return shelf
+}
+
+func (app *application) updateShelfHandler(w http.ResponseWriter, r *http.Request) {
+	shelf := app.getShelf(w, r)
+	if shelf == nil {
+		return
+	}
+
+	if shelf.Exclusive {
+		app.builtInShelfResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Name *string `json:"name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		shelf.Name = *input.Name
+	}
+
+	v := validator.New()
+	if data.ValidateShelf(v, shelf); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Shelves.Update(shelf)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateShelf):
+			v.AddError("name", "a shelf with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"shelf": shelf}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteShelfHandler(w http.ResponseWriter, r *http.Request) {
+	shelf := app.getShelf(w, r)
+	if shelf == nil {
+		return
+	}
+
+	if shelf.Exclusive {
+		app.builtInShelfResponse(w, r)
+		return
+	}
+
+	err := app.models.Shelves.Delete(shelf.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "shelf successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listShelfBooksHandler lists the books on a shelf, taking the same filters,
+// sparse fieldsets and pagination as listBooksHandler.
+func (app *application) listShelfBooksHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.BookFilters
+		data.Filters
+	}
+
+	v := validator.New()
+
+	input.BookFilters, input.Filters = app.readBookListing(r.URL.Query(), false, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	shelf := app.getShelf(w, r)
+	if shelf == nil {
+		return
+	}
+	input.ShelfID = shelf.ID
+
+	books, metadata, err := app.models.Books.GetAll(input.BookFilters, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"books": books, "metadata": metadata}
+	if len(input.Fields) > 0 {
+		env["books"] = newResources(books, input.Fields)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// addShelfBookHandler puts a book on a shelf. Putting a book on one of the
+// reading shelves takes it off the other two.
+func (app *application) addShelfBookHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := app.readBookParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	shelf := app.getShelf(w, r)
+	if shelf == nil {
+		return
+	}
+
+	_, err = app.models.Books.Get(bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+	err = app.models.Shelves.AddEntries(user.ID, []data.ShelfEntry{{Shelf: shelf.Name, BookID: bookID}})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	shelf, err = app.models.Shelves.GetForUser(user.ID, shelf.Name)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"shelf": shelf}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) removeShelfBookHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := app.readBookParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	shelf := app.getShelf(w, r)
+	if shelf == nil {
+		return
+	}
+
+	err = app.models.Shelves.RemoveBook(shelf.ID, bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "book successfully removed from shelf"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"Books/internal/data"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// showStatsHandler sums up the reading of the current user, along with their
+// goal for this year if they have set one.
+func (app *application) showStatsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	stats, err := app.models.Stats.GetForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	goal, err := app.models.Goals.Get(user.ID, time.Now().UTC().Year())
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"stats": stats, "goal": goal}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
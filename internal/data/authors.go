@@ -0,0 +1,365 @@
+package data
+
+import (
+	"Books/internal/validator"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDuplicateAuthor = errors.New("duplicate author")
+	ErrUnknownAuthor   = errors.New("unknown author")
+	ErrAuthorInUse     = errors.New("author in use")
+)
+
+const (
+	RoleAuthor      = "author"
+	RoleTranslator  = "translator"
+	RoleEditor      = "editor"
+	RoleIllustrator = "illustrator"
+)
+
+var AuthorRoles = []string{RoleAuthor, RoleTranslator, RoleEditor, RoleIllustrator}
+
+type Author struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Name      string    `json:"name"`
+	Version   int32     `json:"version"`
+}
+
+// BookAuthor is an author as linked to a particular book. Either ID or Name
+// identifies the author when it's supplied by a client.
+type BookAuthor struct {
+	ID   int64  `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+	Role string `json:"role,omitempty"`
+}
+
+type BookAuthors []BookAuthor
+
+// Scan reads the JSON array built by bookAuthorsColumn.
+func (a *BookAuthors) Scan(src any) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, a)
+	case string:
+		return json.Unmarshal([]byte(v), a)
+	case nil:
+		*a = BookAuthors{}
+		return nil
+	default:
+		return fmt.Errorf("unsupported type %T for book authors", src)
+	}
+}
+
+// Names returns the author names in order, joined for the denormalized
+// books.authors column.
+func (a BookAuthors) Names() string {
+	names := make([]string, len(a))
+	for i := range a {
+		names[i] = a[i].Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// bookAuthorsColumn selects the structured authors of the books row in scope
+// as a JSON array ordered by position.
+const bookAuthorsColumn = `
+			COALESCE((
+				SELECT json_agg(json_build_object('id', authors.id, 'name', authors.name, 'role', book_authors.role) ORDER BY book_authors.position)
+				FROM book_authors
+				INNER JOIN authors ON authors.id = book_authors.author_id
+				WHERE book_authors.book_id = books.id
+			), '[]')`
+
+func ValidateAuthor(v *validator.Validator, author *Author) {
+	v.Check(strings.TrimSpace(author.Name) != "", "name", "must be provided")
+	v.Check(len(author.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(!strings.Contains(author.Name, ","), "name", "must not contain commas")
+}
+
+func ValidateBookAuthors(v *validator.Validator, authors BookAuthors) {
+	v.Check(authors != nil, "authors", "must be provided")
+	v.Check(len(authors) >= 1, "authors", "must contain at least 1 author")
+	v.Check(len(authors) <= 20, "authors", "must not contain more than 20 authors")
+
+	keys := make([]string, len(authors))
+	for i, a := range authors {
+		v.Check(a.ID > 0 || strings.TrimSpace(a.Name) != "", "authors", "each author must have an id or a name")
+		v.Check(len(a.Name) <= 500, "authors", "author names must not be more than 500 bytes long")
+		v.Check(!strings.Contains(a.Name, ","), "authors", "author names must not contain commas")
+		v.Check(a.Role == "" || validator.PermittedValue(a.Role, AuthorRoles...), "authors", "role must be one of author, translator, editor or illustrator")
+		keys[i] = fmt.Sprintf("%d|%s|%s", a.ID, strings.ToLower(strings.TrimSpace(a.Name)), a.Role)
+	}
+	v.Check(validator.Unique(keys), "authors", "must not contain duplicate values")
+}
+
+type AuthorModel struct {
+	DB *sql.DB
+}
+
+func (m AuthorModel) Insert(author *Author) error {
+	query := `
+			INSERT INTO authors (name)
+			VALUES ($1)
+			RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, author.Name).Scan(&author.ID, &author.CreatedAt, &author.Version)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err, "authors_name_key"):
+			return ErrDuplicateAuthor
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m AuthorModel) Get(id int64) (*Author, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+			SELECT id, created_at, name, version
+			FROM authors
+			WHERE id = $1`
+
+	var author Author
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&author.ID,
+		&author.CreatedAt,
+		&author.Name,
+		&author.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &author, nil
+}
+
+func (m AuthorModel) GetAll(name string, filters Filters) ([]*Author, Metadata, error) {
+	query := fmt.Sprintf(`
+			SELECT count(*) OVER(), id, created_at, name, version
+			FROM authors
+			WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+			ORDER BY %s %s, id ASC
+			LIMIT $2 OFFSET $3`,
+		filters.sortColumn(),
+		filters.sortDirection(),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	authors := []*Author{}
+
+	for rows.Next() {
+		var author Author
+
+		err := rows.Scan(
+			&totalRecords,
+			&author.ID,
+			&author.CreatedAt,
+			&author.Name,
+			&author.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		authors = append(authors, &author)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return authors, metadata, nil
+}
+
+// Update renames an author and refreshes the denormalized authors text of
+// every book the author is linked to, so a misspelling is fixed in one place.
+func (m AuthorModel) Update(author *Author, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+			UPDATE authors
+			SET name = $1, version = version + 1
+			WHERE id = $2 AND version = $3
+			RETURNING version`
+
+	err = tx.QueryRowContext(ctx, query, author.Name, author.ID, author.Version).Scan(&author.Version)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err, "authors_name_key"):
+			return ErrDuplicateAuthor
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	query = `
+			UPDATE books
+			SET authors = (
+				SELECT string_agg(authors.name, ', ' ORDER BY book_authors.position)
+				FROM book_authors
+				INNER JOIN authors ON authors.id = book_authors.author_id
+				WHERE book_authors.book_id = books.id
+			), version = version + 1
+			WHERE id IN (SELECT book_id FROM book_authors WHERE author_id = $1)
+			RETURNING id`
+
+	rows, err := tx.QueryContext(ctx, query, author.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var bookIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		bookIDs = append(bookIDs, id)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	err = insertBookRevisions(ctx, tx, userID, bookIDs)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m AuthorModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+			DELETE FROM authors
+			WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return ErrAuthorInUse
+		}
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// resolveBookAuthors fills in the ID and Name of every author, creating
+// authors that are referenced by a name we haven't seen before.
+func resolveBookAuthors(ctx context.Context, tx *sql.Tx, authors BookAuthors) error {
+	for i := range authors {
+		if authors[i].Role == "" {
+			authors[i].Role = RoleAuthor
+		}
+
+		if authors[i].ID != 0 {
+			query := `
+					SELECT name
+					FROM authors
+					WHERE id = $1`
+
+			err := tx.QueryRowContext(ctx, query, authors[i].ID).Scan(&authors[i].Name)
+			if err != nil {
+				switch {
+				case errors.Is(err, sql.ErrNoRows):
+					return ErrUnknownAuthor
+				default:
+					return err
+				}
+			}
+			continue
+		}
+
+		query := `
+				INSERT INTO authors (name)
+				VALUES ($1)
+				ON CONFLICT (name) DO UPDATE SET name = authors.name
+				RETURNING id, name`
+
+		err := tx.QueryRowContext(ctx, query, strings.TrimSpace(authors[i].Name)).Scan(&authors[i].ID, &authors[i].Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setBookAuthors replaces the author links of a book with the given
+// (already resolved) authors, preserving their order.
+func setBookAuthors(ctx context.Context, tx *sql.Tx, bookID int64, authors BookAuthors) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM book_authors WHERE book_id = $1`, bookID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+			INSERT INTO book_authors (book_id, author_id, position, role)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT DO NOTHING`
+
+	for i, a := range authors {
+		_, err = tx.ExecContext(ctx, query, bookID, a.ID, i+1, a.Role)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
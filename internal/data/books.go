@@ -7,55 +7,115 @@ import (
 	"errors"
 	"fmt"
 	"github.com/lib/pq"
+	"strconv"
+	"strings"
 	"time"
 )
 
+var (
+	ErrDuplicateISBN = errors.New("duplicate isbn")
+)
+
 type Book struct {
-	ID        int64     `json:"id"`
-	Title     string    `json:"title"`
-	Authors   string    `json:"authors"`
-	Rating    float64   `json:"rating"`
-	ISBN      string    `json:"ISBN"`
-	ISBN13    string    `json:"ISBN13"`
-	Language  string    `json:"language,omitempty"`
-	Genres    []string  `json:"genres,omitempty"`
-	Pages     Pages     `json:"pages,omitempty,string"`
-	CreatedAt time.Time `json:"-"`
-	Version   int32     `json:"version"`
+	ID          int64             `json:"id"`
+	Title       string            `json:"title"`
+	Authors     BookAuthors       `json:"authors"`
+	Rating      float64           `json:"rating"`
+	RatingCount int               `json:"rating_count"`
+	ISBN        string            `json:"ISBN"`
+	ISBN13      string            `json:"ISBN13"`
+	Language    string            `json:"language,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Genres      []string          `json:"genres,omitempty"`
+	Pages       Pages             `json:"pages,omitempty,string"`
+	CreatedAt   time.Time         `json:"-"`
+	DeletedAt   *time.Time        `json:"deleted_at,omitempty"`
+	Version     int32             `json:"version"`
+	Highlights  map[string]string `json:"highlights,omitempty"`
+	Similarity  float64           `json:"similarity,omitempty"`
 }
 
 func ValidateBook(v *validator.Validator, book *Book) {
 	v.Check(book.Title != "", "title", "must be provided")
-	v.Check(book.Authors != "", "authors", "must be provided")
+	ValidateBookAuthors(v, book.Authors)
 	v.Check(len(book.Title) <= 500, "title", "must not be more than 500 bytes long")
-	v.Check(book.ISBN != "", "ISBN", "must be provided")
-	v.Check(book.ISBN13 != "", "ISBN13", "must be provided")
-	v.Check(book.Rating != 0, "rating", "must be provided")
-	v.Check(book.Rating > 0, "rating", "must be greater than 0")
-	v.Check(book.Rating <= 5, "rating", "must be less than 5")
+	validateISBNs(v, book)
 	v.Check(book.Pages != 0, "pages", "must be provided")
 	v.Check(book.Pages > 0, "pages", "must be a positive integer")
 	v.Check(book.Genres != nil, "genres", "must be provided")
 	v.Check(book.Language != "", "language", "must be provided")
+	v.Check(len(book.Description) <= 10_000, "description", "must not be more than 10000 bytes long")
 	v.Check(len(book.Genres) >= 1, "genres", "must contain at least 1 genre")
 	v.Check(len(book.Genres) <= 5, "genres", "must not contain more than 5 genres")
 	v.Check(validator.Unique(book.Genres), "genres", "must not contain duplicate values")
 }
 
+// validateISBNs expects the ISBNs of the book to already be in the canonical
+// form produced by validator.NormalizeISBN. A book without an ISBN-10 is only
+// accepted when its ISBN-13 has no ISBN-10 equivalent (the 979 prefix).
+func validateISBNs(v *validator.Validator, book *Book) {
+	v.Check(book.ISBN13 != "", "ISBN13", "must be provided")
+	v.Check(book.ISBN13 == "" || validator.ValidISBN13(book.ISBN13), "ISBN13", "must be a valid ISBN-13")
+	v.Check(book.ISBN == "" || validator.ValidISBN10(book.ISBN), "ISBN", "must be a valid ISBN-10")
+
+	if !validator.ValidISBN13(book.ISBN13) {
+		return
+	}
+
+	isbn10, hasISBN10 := validator.ISBN13To10(book.ISBN13)
+	v.Check(book.ISBN != "" || !hasISBN10, "ISBN", "must be provided")
+
+	if validator.ValidISBN10(book.ISBN) {
+		v.Check(book.ISBN == isbn10, "ISBN", "must refer to the same book as ISBN13")
+	}
+}
+
 type BookModel struct {
 	DB *sql.DB
 }
 
-func (b BookModel) Insert(book *Book) error {
+func (b BookModel) Insert(book *Book, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := b.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = resolveBookAuthors(ctx, tx, book.Authors)
+	if err != nil {
+		return err
+	}
+
 	query := `
-			INSERT INTO books (title, authors,rating, pages, genres,isbn,isbn13,language)
+			INSERT INTO books (title, authors, pages, genres,isbn,isbn13,language,description)
 			VALUES ($1, $2, $3, $4, $5,$6,$7,$8)
 			RETURNING id, created_at, version`
 
-	args := []any{book.Title, book.Authors, book.Rating, book.Pages, pq.Array(book.Genres), book.ISBN, book.ISBN13, book.Language}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-	return b.DB.QueryRowContext(ctx, query, args...).Scan(&book.ID, &book.CreatedAt, &book.Version)
+	args := []any{book.Title, book.Authors.Names(), book.Pages, pq.Array(book.Genres), book.ISBN, book.ISBN13, book.Language, book.Description}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&book.ID, &book.CreatedAt, &book.Version)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err, "books_isbn13_key"):
+			return ErrDuplicateISBN
+		default:
+			return err
+		}
+	}
+
+	err = setBookAuthors(ctx, tx, book.ID, book.Authors)
+	if err != nil {
+		return err
+	}
+
+	err = insertBookRevisions(ctx, tx, userID, []int64{book.ID})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (b BookModel) Get(id int64) (*Book, error) {
@@ -63,10 +123,10 @@ func (b BookModel) Get(id int64) (*Book, error) {
 		return nil, ErrRecordNotFound
 	}
 
-	query := `
-			SELECT  id, created_at, title, authors,rating, pages, genres,isbn,isbn13,language,version
+	query := fmt.Sprintf(`
+			SELECT  id, created_at, title, %s, rating, rating_count, pages, genres,isbn,isbn13,language,description,version
 			FROM books
-			WHERE id = $1`
+			WHERE id = $1 AND deleted_at IS NULL`, bookAuthorsColumn)
 
 	var book Book
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -78,11 +138,49 @@ func (b BookModel) Get(id int64) (*Book, error) {
 		&book.Title,
 		&book.Authors,
 		&book.Rating,
+		&book.RatingCount,
+		&book.Pages,
+		pq.Array(&book.Genres),
+		&book.ISBN,
+		&book.ISBN13,
+		&book.Language,
+		&book.Description,
+		&book.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &book, nil
+}
+
+func (b BookModel) GetByISBN13(isbn13 string) (*Book, error) {
+	query := fmt.Sprintf(`
+			SELECT  id, created_at, title, %s, rating, rating_count, pages, genres,isbn,isbn13,language,description,version
+			FROM books
+			WHERE isbn13 = $1 AND deleted_at IS NULL`, bookAuthorsColumn)
+
+	var book Book
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+
+	defer cancel()
+	err := b.DB.QueryRowContext(ctx, query, isbn13).Scan(
+		&book.ID,
+		&book.CreatedAt,
+		&book.Title,
+		&book.Authors,
+		&book.Rating,
+		&book.RatingCount,
 		&book.Pages,
 		pq.Array(&book.Genres),
 		&book.ISBN,
 		&book.ISBN13,
 		&book.Language,
+		&book.Description,
 		&book.Version,
 	)
 	if err != nil {
@@ -96,23 +194,238 @@ func (b BookModel) Get(id int64) (*Book, error) {
 	return &book, nil
 }
 
-func (b BookModel) GetAll(title string, genres []string, filters Filters) ([]*Book, Metadata, error) {
+// GetFields fetches a book like Get, but only selects the given fields of
+// BookFields, along with the required ones.
+func (b BookModel) GetFields(id int64, fields []string, required ...string) (*Book, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
 
+	columns, bookDests := selectBookColumns(fields, required...)
 	query := fmt.Sprintf(`
-			SELECT count(*) OVER(), id, created_at, title, authors,rating, pages, genres,isbn,isbn13,language,version
+			SELECT %s
 			FROM books
-			WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-			AND (genres @> $2 OR $2 = '{}')
-			ORDER BY %s %s, id ASC
-			LIMIT $3 OFFSET $4`,
-		filters.sortColumn(),
-		filters.sortDirection(),
+			WHERE id = $1 AND deleted_at IS NULL`, columns)
+
+	var book Book
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := b.DB.QueryRowContext(ctx, query, id).Scan(bookDests(&book)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &book, nil
+}
+
+// BookFields are the fields of a book a sparse fieldset can pick from.
+var BookFields = []string{"id", "title", "authors", "rating", "rating_count", "ISBN", "ISBN13", "language", "description", "genres", "pages", "version"}
+
+type bookColumn struct {
+	expr string
+	dest func(*Book) any
+}
+
+// bookColumns maps each of BookFields to the expression that selects it and
+// the Book field it scans into.
+var bookColumns = map[string]bookColumn{
+	"id":           {"id", func(book *Book) any { return &book.ID }},
+	"title":        {"title", func(book *Book) any { return &book.Title }},
+	"authors":      {bookAuthorsColumn, func(book *Book) any { return &book.Authors }},
+	"rating":       {"rating", func(book *Book) any { return &book.Rating }},
+	"rating_count": {"rating_count", func(book *Book) any { return &book.RatingCount }},
+	"ISBN":         {"isbn", func(book *Book) any { return &book.ISBN }},
+	"ISBN13":       {"isbn13", func(book *Book) any { return &book.ISBN13 }},
+	"language":     {"language", func(book *Book) any { return &book.Language }},
+	"description":  {"description", func(book *Book) any { return &book.Description }},
+	"genres":       {"genres", func(book *Book) any { return pq.Array(&book.Genres) }},
+	"pages":        {"pages", func(book *Book) any { return &book.Pages }},
+	"version":      {"version", func(book *Book) any { return &book.Version }},
+}
+
+// selectBookColumns returns the select list for fields, or for all of
+// BookFields when fields is empty, and a function giving the matching scan
+// destinations of a book. The id and the required fields are always
+// selected.
+func selectBookColumns(fields []string, required ...string) (string, func(*Book) []any) {
+	if len(fields) == 0 {
+		fields = BookFields
+	}
+
+	selected := []string{"id"}
+	for _, field := range append(required, fields...) {
+		if _, ok := bookColumns[field]; ok && !validator.PermittedValue(field, selected...) {
+			selected = append(selected, field)
+		}
+	}
+
+	exprs := make([]string, len(selected))
+	for i, field := range selected {
+		exprs[i] = bookColumns[field].expr
+	}
+
+	dests := func(book *Book) []any {
+		d := make([]any, len(selected))
+		for i, field := range selected {
+			d[i] = bookColumns[field].dest(book)
+		}
+		return d
+	}
+	return strings.Join(exprs, ", "), dests
+}
+
+// BookFilters narrows down a book listing. Zero values leave a filter out.
+// Fields limits the columns selected to a sparse fieldset of BookFields, and
+// ShelfID to the books on one shelf.
+type BookFilters struct {
+	Fields        []string
+	ShelfID       int64
+	Title         string
+	Query         string
+	Genres        []string
+	GenresMode    string
+	Language      string
+	Authors       []string
+	MinRating     float64
+	MaxRating     float64
+	MinPages      int
+	MaxPages      int
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+const (
+	GenresModeAll = "all"
+	GenresModeAny = "any"
+)
+
+func ValidateBookFilters(v *validator.Validator, f BookFilters) {
+	v.Check(validator.PermittedValue(f.GenresMode, GenresModeAll, GenresModeAny), "genres_mode", "must be either any or all")
+	v.Check(len(f.Genres) <= 20, "genres", "must not contain more than 20 genres")
+	v.Check(len(f.Language) <= 20, "language", "must not be more than 20 bytes long")
+	v.Check(len(f.Authors) <= 20, "authors", "must not contain more than 20 authors")
+	v.Check(f.MinRating >= 0 && f.MinRating <= 5, "min_rating", "must be between 0 and 5")
+	v.Check(f.MaxRating >= 0 && f.MaxRating <= 5, "max_rating", "must be between 0 and 5")
+	v.Check(f.MaxRating == 0 || f.MinRating <= f.MaxRating, "min_rating", "must not be greater than max_rating")
+	v.Check(f.MinPages >= 0, "min_pages", "must not be negative")
+	v.Check(f.MaxPages >= 0, "max_pages", "must not be negative")
+	v.Check(f.MaxPages == 0 || f.MinPages <= f.MaxPages, "min_pages", "must not be greater than max_pages")
+	v.Check(f.CreatedBefore.IsZero() || f.CreatedAfter.Before(f.CreatedBefore), "created_after", "must be before created_before")
+}
+
+// apply adds a condition for every filter that is set, and always leaves out
+// the books in the trash.
+func (f BookFilters) apply(qb *queryBuilder) {
+	qb.where("deleted_at IS NULL")
+
+	if f.ShelfID != 0 {
+		qb.where(fmt.Sprintf(`EXISTS (
+				SELECT 1
+				FROM shelf_books
+				WHERE shelf_books.book_id = books.id AND shelf_books.shelf_id = %s
+			)`, qb.arg(f.ShelfID)))
+	}
+	if f.Title != "" {
+		qb.where(fmt.Sprintf("to_tsvector('simple', title) @@ plainto_tsquery('simple', %s)", qb.arg(f.Title)))
+	}
+	if f.Query != "" {
+		qb.where(fmt.Sprintf("search_vector @@ websearch_to_tsquery('simple', %s)", qb.arg(f.Query)))
+	}
+	if len(f.Genres) > 0 {
+		op := "@>"
+		if f.GenresMode == GenresModeAny {
+			op = "&&"
+		}
+		qb.where(fmt.Sprintf("genres %s %s", op, qb.arg(pq.Array(f.Genres))))
+	}
+	if f.Language != "" {
+		qb.where(fmt.Sprintf("lower(language) = lower(%s)", qb.arg(f.Language)))
+	}
+	if len(f.Authors) > 0 {
+		qb.where(fmt.Sprintf(`EXISTS (
+				SELECT 1
+				FROM book_authors
+				INNER JOIN authors ON authors.id = book_authors.author_id
+				WHERE book_authors.book_id = books.id AND authors.name = ANY(%s::citext[])
+			)`, qb.arg(pq.Array(f.Authors))))
+	}
+	if f.MinRating > 0 {
+		qb.where("rating >= " + qb.arg(f.MinRating))
+	}
+	if f.MaxRating > 0 {
+		qb.where("rating <= " + qb.arg(f.MaxRating))
+	}
+	if f.MinPages > 0 {
+		qb.where("pages >= " + qb.arg(f.MinPages))
+	}
+	if f.MaxPages > 0 {
+		qb.where("pages <= " + qb.arg(f.MaxPages))
+	}
+	if !f.CreatedAfter.IsZero() {
+		qb.where("created_at >= " + qb.arg(f.CreatedAfter))
+	}
+	if !f.CreatedBefore.IsZero() {
+		qb.where("created_at < " + qb.arg(f.CreatedBefore))
+	}
+}
+
+// GetAll lists books either by page, with the total count in the metadata, or
+// after the keyset cursor in filters. Either way the metadata carries a
+// next_cursor while there are more rows, so clients can switch to cursors
+// after the first page.
+//
+// The Query filter is a full-text query in websearch_to_tsquery syntax
+// matched against the title, authors and description of the books. When it
+// is set each book carries highlighted snippets of the fields that matched,
+// and the "relevance" sort orders by ts_rank_cd.
+func (b BookModel) GetAll(bookFilters BookFilters, filters Filters) ([]*Book, Metadata, error) {
+	qb := &queryBuilder{}
+	bookFilters.apply(qb)
+	filters.applyCursor(qb)
+
+	// The cursor of the next page needs the sort column of the last book.
+	columns, bookDests := selectBookColumns(bookFilters.Fields, filters.sortColumn())
+
+	totalColumn := "count(*) OVER()"
+	if filters.Cursor != "" {
+		totalColumn = "0"
+	}
+
+	highlightColumns := "'', '', ''"
+	orderBy := fmt.Sprintf("%s %s, id ASC", filters.sortColumn(), filters.sortDirection())
+	if bookFilters.Query != "" {
+		q := qb.arg(bookFilters.Query)
+		highlightColumns = bookHighlightColumns(q)
+		if filters.Sort == "relevance" {
+			orderBy = fmt.Sprintf("ts_rank_cd(search_vector, websearch_to_tsquery('simple', %s)) DESC, id ASC", q)
+		}
+	}
+
+	// One extra row tells us whether there is a next page.
+	query := fmt.Sprintf(`
+			SELECT %s, %s,
+				%s
+			FROM books
+			%s
+			ORDER BY %s
+			LIMIT %s OFFSET %s`,
+		totalColumn,
+		columns,
+		highlightColumns,
+		qb.whereClause(),
+		orderBy,
+		qb.arg(filters.limit()+1),
+		qb.arg(filters.offset()),
 	)
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{title, pq.Array(genres), filters.limit(), filters.offset()}
-	rows, err := b.DB.QueryContext(ctx, query, args...)
+	rows, err := b.DB.QueryContext(ctx, query, qb.args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -124,21 +437,148 @@ func (b BookModel) GetAll(title string, genres []string, filters Filters) ([]*Bo
 
 	for rows.Next() {
 		var book Book
+		var highlights [3]string
 
-		err := rows.Scan(
-			&totalRecords,
-			&book.ID,
-			&book.CreatedAt,
-			&book.Title,
-			&book.Authors,
-			&book.Rating,
-			&book.Pages,
-			pq.Array(&book.Genres),
-			&book.ISBN,
-			&book.ISBN13,
-			&book.Language,
-			&book.Version,
-		)
+		dest := append([]any{&totalRecords}, bookDests(&book)...)
+		err := rows.Scan(append(dest, &highlights[0], &highlights[1], &highlights[2])...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		book.setHighlights(highlights)
+		books = append(books, &book)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	hasMore := len(books) > filters.limit()
+	if hasMore {
+		books = books[:filters.limit()]
+	}
+
+	var metadata Metadata
+	if filters.Cursor == "" {
+		metadata = calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	} else {
+		metadata = Metadata{PageSize: filters.PageSize}
+	}
+	if hasMore && filters.Sort != "relevance" {
+		last := books[len(books)-1]
+		metadata.NextCursor = filters.nextCursor(last.sortValue(filters.sortColumn()), last.ID)
+	}
+	return books, metadata, nil
+}
+
+// GetFacets counts how the books matching the same filters as GetAll are
+// spread over each of the requested facets.
+func (b BookModel) GetFacets(bookFilters BookFilters, names []string) (Facets, error) {
+	facets := Facets{}
+	if len(names) == 0 {
+		return facets, nil
+	}
+
+	aggregates := make([]string, len(names))
+	for i, name := range names {
+		aggregates[i] = facetQueries[name]
+		facets[name] = []FacetCount{}
+	}
+
+	qb := &queryBuilder{}
+	bookFilters.apply(qb)
+
+	query := fmt.Sprintf(`
+			WITH matched AS (
+				SELECT genres, language, rating, pages
+				FROM books
+				%s
+			)
+			SELECT facet, value, count
+			FROM (%s) AS facets (facet, value, bucket, count)
+			ORDER BY facet, bucket, count DESC, value`,
+		qb.whereClause(),
+		strings.Join(aggregates, "\n\t\t\tUNION ALL"),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := b.DB.QueryContext(ctx, query, qb.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var count FacetCount
+
+		err := rows.Scan(&name, &count.Value, &count.Count)
+		if err != nil {
+			return nil, err
+		}
+		facets[name] = append(facets[name], count)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return facets, nil
+}
+
+// GetAllFuzzy lists the books whose title or authors are similar to term by
+// trigram similarity, so misspelled searches still find something. The
+// Title and Query filters are ignored in favour of term. Each book carries
+// its similarity score, which the "relevance" sort orders by.
+func (b BookModel) GetAllFuzzy(term string, bookFilters BookFilters, filters Filters) ([]*Book, Metadata, error) {
+	bookFilters.Title, bookFilters.Query = "", ""
+
+	qb := &queryBuilder{}
+	bookFilters.apply(qb)
+
+	t := qb.arg(term)
+	qb.where(fmt.Sprintf("(title %% %s OR %s <%% authors)", t, t))
+
+	columns, bookDests := selectBookColumns(bookFilters.Fields)
+
+	orderBy := fmt.Sprintf("%s %s, id ASC", filters.sortColumn(), filters.sortDirection())
+	if filters.Sort == "relevance" {
+		orderBy = "similarity DESC, id ASC"
+	}
+
+	query := fmt.Sprintf(`
+			SELECT count(*) OVER(), %s,
+				GREATEST(similarity(title, %s), word_similarity(%s, authors)) AS similarity
+			FROM books
+			%s
+			ORDER BY %s
+			LIMIT %s OFFSET %s`,
+		columns,
+		t,
+		t,
+		qb.whereClause(),
+		orderBy,
+		qb.arg(filters.limit()),
+		qb.arg(filters.offset()),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := b.DB.QueryContext(ctx, query, qb.args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	books := []*Book{}
+
+	for rows.Next() {
+		var book Book
+
+		dest := append([]any{&totalRecords}, bookDests(&book)...)
+		err := rows.Scan(append(dest, &book.Similarity)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -152,31 +592,129 @@ func (b BookModel) GetAll(title string, genres []string, filters Filters) ([]*Bo
 	return books, metadata, nil
 }
 
-func (b BookModel) Update(book *Book) error {
+// Suggest returns up to limit book titles and author names that are similar
+// to term, best match first, for "did you mean" hints.
+func (b BookModel) Suggest(term string, limit int) ([]string, error) {
+	query := `
+			SELECT suggestion
+			FROM (
+				SELECT title AS suggestion, similarity(title, $1) AS score
+				FROM books
+				WHERE title % $1 AND deleted_at IS NULL
+				UNION ALL
+				SELECT name::text, similarity(name::text, $1)
+				FROM authors
+				WHERE name::text % $1
+			) AS candidates
+			GROUP BY suggestion
+			ORDER BY max(score) DESC, suggestion ASC
+			LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := b.DB.QueryContext(ctx, query, term, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []string{}
+
+	for rows.Next() {
+		var suggestion string
+
+		err := rows.Scan(&suggestion)
+		if err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return suggestions, nil
+}
+
+// bookHighlightColumns selects ts_headline snippets of the title, authors and
+// description of the books row in scope for the full-text query in the q
+// placeholder.
+func bookHighlightColumns(q string) string {
+	return fmt.Sprintf(`
+				ts_headline('simple', title, websearch_to_tsquery('simple', %[1]s)),
+				ts_headline('simple', authors, websearch_to_tsquery('simple', %[1]s)),
+				ts_headline('simple', description, websearch_to_tsquery('simple', %[1]s), 'MaxFragments=2, MinWords=5, MaxWords=20')`, q)
+}
+
+// setHighlights keeps the title, authors and description snippets that
+// contain a match.
+func (book *Book) setHighlights(snippets [3]string) {
+	for i, field := range []string{"title", "authors", "description"} {
+		if !strings.Contains(snippets[i], "<b>") {
+			continue
+		}
+		if book.Highlights == nil {
+			book.Highlights = make(map[string]string)
+		}
+		book.Highlights[field] = snippets[i]
+	}
+}
+
+// sortValue returns the value of one of the sortable columns of the book in
+// a form Postgres can compare against that column.
+func (book *Book) sortValue(column string) string {
+	switch column {
+	case "title":
+		return book.Title
+	case "pages":
+		return strconv.Itoa(int(book.Pages))
+	case "rating":
+		return strconv.FormatFloat(book.Rating, 'f', -1, 64)
+	default:
+		return strconv.FormatInt(book.ID, 10)
+	}
+}
+
+func (b BookModel) Update(book *Book, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := b.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = resolveBookAuthors(ctx, tx, book.Authors)
+	if err != nil {
+		return err
+	}
+
 	query := `
 			UPDATE books
-			SET title = $1, authors = $2, pages = $3, rating=$4, genres = $5, isbn=$6, isbn13=$7, language=$8, version = version + 1
-			WHERE id = $9 and version = $10
+			SET title = $1, authors = $2, pages = $3, genres = $4, isbn=$5, isbn13=$6, language=$7, description=$8, version = version + 1
+			WHERE id = $9 and version = $10 AND deleted_at IS NULL
 			RETURNING version`
 
 	args := []any{
 		book.Title,
-		book.Authors,
+		book.Authors.Names(),
 		book.Pages,
-		book.Rating,
 		pq.Array(book.Genres),
 		book.ISBN,
 		book.ISBN13,
 		book.Language,
+		book.Description,
 		book.ID,
 		book.Version,
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
 
-	err := b.DB.QueryRowContext(ctx, query, args...).Scan(&book.Version)
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&book.Version)
 	if err != nil {
 		switch {
+		case isUniqueViolation(err, "books_isbn13_key"):
+			return ErrDuplicateISBN
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
 		default:
@@ -184,23 +722,116 @@ func (b BookModel) Update(book *Book) error {
 
 		}
 	}
-	return nil
+
+	err = setBookAuthors(ctx, tx, book.ID, book.Authors)
+	if err != nil {
+		return err
+	}
+
+	err = insertBookRevisions(ctx, tx, userID, []int64{book.ID})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete moves a book to the trash. It stays there until it is restored,
+// purged, or removed by PurgeDeletedBefore once the retention period is over.
+// Delete moves a book to the trash. A non-zero version is the version the
+// caller expects the book to be at: when the book has changed since, nothing
+// is deleted and ErrEditConflict is returned.
+func (b BookModel) Delete(id int64, version int32, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+			UPDATE books
+			SET deleted_at = NOW(), version = version + 1
+			WHERE id = $1 AND deleted_at IS NULL AND ($2 = 0 OR version = $2)`
+
+	err := b.setDeletedAt(id, userID, query, version)
+	if errors.Is(err, ErrRecordNotFound) && version != 0 {
+		return ErrEditConflict
+	}
+	return err
+}
+
+func (b BookModel) Restore(id int64, userID int64) (*Book, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+			UPDATE books
+			SET deleted_at = NULL, version = version + 1
+			WHERE id = $1 AND deleted_at IS NOT NULL`
+
+	err := b.setDeletedAt(id, userID, query)
+	if err != nil {
+		return nil, err
+	}
+	return b.Get(id)
+}
+
+// setDeletedAt runs one of the trash/restore queries, with the id of the book
+// and args as its arguments, and records the resulting revision.
+func (b BookModel) setDeletedAt(id int64, userID int64, query string, args ...any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := b.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, append([]any{id}, args...)...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	err = insertBookRevisions(ctx, tx, userID, []int64{id})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (b BookModel) Delete(id int64) error {
+// Purge permanently removes a book that is already in the trash. A book that
+// has library copies, withdrawn ones included, keeps them for their loan
+// history and gives ErrBookHasCopies.
+func (b BookModel) Purge(id int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
 	query := `
 			DELETE FROM books
-			WHERE id = $1`
+			WHERE id = $1 AND deleted_at IS NOT NULL`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	result, err := b.DB.ExecContext(ctx, query, id)
 	if err != nil {
-		return err
+		var pqErr *pq.Error
+		switch {
+		case errors.As(err, &pqErr) && pqErr.Code == "23503" && pqErr.Constraint == "copies_book_id_fkey":
+			return ErrBookHasCopies
+		default:
+			return err
+		}
 	}
 
 	rowsAffected, err := result.RowsAffected()
@@ -213,3 +844,135 @@ func (b BookModel) Delete(id int64) error {
 	}
 	return nil
 }
+
+// PurgeDeletedBefore permanently removes every book that was moved to the
+// trash before cutoff and returns how many were removed. Books with library
+// copies are left in the trash, as Purge would refuse them.
+func (b BookModel) PurgeDeletedBefore(cutoff time.Time) (int64, error) {
+	query := `
+			DELETE FROM books
+			WHERE deleted_at IS NOT NULL AND deleted_at < $1
+				AND NOT EXISTS (SELECT 1 FROM copies WHERE copies.book_id = books.id)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	result, err := b.DB.ExecContext(ctx, query, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (b BookModel) GetAllDeleted(filters Filters) ([]*Book, Metadata, error) {
+	query := fmt.Sprintf(`
+			SELECT count(*) OVER(), id, created_at, title, %s, rating, rating_count, pages, genres,isbn,isbn13,language,description,deleted_at,version
+			FROM books
+			WHERE deleted_at IS NOT NULL
+			ORDER BY %s %s, id ASC
+			LIMIT $1 OFFSET $2`,
+		bookAuthorsColumn,
+		filters.sortColumn(),
+		filters.sortDirection(),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := b.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	books := []*Book{}
+
+	for rows.Next() {
+		var book Book
+
+		err := rows.Scan(
+			&totalRecords,
+			&book.ID,
+			&book.CreatedAt,
+			&book.Title,
+			&book.Authors,
+			&book.Rating,
+			&book.RatingCount,
+			&book.Pages,
+			pq.Array(&book.Genres),
+			&book.ISBN,
+			&book.ISBN13,
+			&book.Language,
+			&book.Description,
+			&book.DeletedAt,
+			&book.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		books = append(books, &book)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return books, metadata, nil
+}
+
+func (b BookModel) GetAllForAuthor(authorID int64, filters Filters) ([]*Book, Metadata, error) {
+	query := fmt.Sprintf(`
+			SELECT count(*) OVER(), id, created_at, title, %s, rating, rating_count, pages, genres,isbn,isbn13,language,description,version
+			FROM books
+			WHERE id IN (SELECT book_id FROM book_authors WHERE author_id = $1)
+			AND deleted_at IS NULL
+			ORDER BY %s %s, id ASC
+			LIMIT $2 OFFSET $3`,
+		bookAuthorsColumn,
+		filters.sortColumn(),
+		filters.sortDirection(),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := b.DB.QueryContext(ctx, query, authorID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	books := []*Book{}
+
+	for rows.Next() {
+		var book Book
+
+		err := rows.Scan(
+			&totalRecords,
+			&book.ID,
+			&book.CreatedAt,
+			&book.Title,
+			&book.Authors,
+			&book.Rating,
+			&book.RatingCount,
+			&book.Pages,
+			pq.Array(&book.Genres),
+			&book.ISBN,
+			&book.ISBN13,
+			&book.Language,
+			&book.Description,
+			&book.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		books = append(books, &book)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return books, metadata, nil
+}
@@ -0,0 +1,43 @@
+package data
+
+import (
+	"Books/internal/validator"
+	"testing"
+)
+
+func TestValidateISBNs(t *testing.T) {
+	tests := []struct {
+		name   string
+		isbn   string
+		isbn13 string
+		errors map[string]string
+	}{
+		{"both", "0306406152", "9780306406157", map[string]string{}},
+		{"979 only", "", "9791090636071", map[string]string{}},
+		{"missing ISBN-10", "", "9780306406157", map[string]string{"ISBN": "must be provided"}},
+		{"mismatch", "080442957X", "9780306406157", map[string]string{"ISBN": "must refer to the same book as ISBN13"}},
+		{"missing ISBN-13", "0306406152", "", map[string]string{"ISBN13": "must be provided"}},
+		{"short 978", "", "978", map[string]string{"ISBN13": "must be a valid ISBN-13"}},
+		{"short 9781", "0306406152", "9781", map[string]string{"ISBN13": "must be a valid ISBN-13"}},
+		{"malformed", "03064O6152", "978030640615X", map[string]string{
+			"ISBN":   "must be a valid ISBN-10",
+			"ISBN13": "must be a valid ISBN-13",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			validateISBNs(v, &Book{ISBN: tt.isbn, ISBN13: tt.isbn13})
+
+			if len(v.Errors) != len(tt.errors) {
+				t.Fatalf("got errors %v; want %v", v.Errors, tt.errors)
+			}
+			for key, message := range tt.errors {
+				if v.Errors[key] != message {
+					t.Errorf("got %q for %s; want %q", v.Errors[key], key, message)
+				}
+			}
+		})
+	}
+}
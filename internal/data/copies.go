@@ -0,0 +1,250 @@
+package data
+
+import (
+	"Books/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrDuplicateBarcode = errors.New("duplicate barcode")
+	ErrCopyOnLoan       = errors.New("copy on loan")
+	ErrBookHasCopies    = errors.New("book has copies")
+)
+
+var CopyConditions = []string{"new", "good", "fair", "poor", "damaged"}
+
+// Copy is a physical copy of a book in the lending library. OnLoan is set
+// while the copy is checked out. Withdrawn copies are kept for their loan
+// history but are otherwise gone from the library.
+type Copy struct {
+	ID        int64     `json:"id"`
+	BookID    int64     `json:"book_id"`
+	Barcode   string    `json:"barcode"`
+	Condition string    `json:"condition"`
+	Location  string    `json:"location"`
+	OnLoan    bool      `json:"on_loan"`
+	CreatedAt time.Time `json:"created_at"`
+	Version   int32     `json:"version"`
+}
+
+func ValidateCopy(v *validator.Validator, bookCopy *Copy) {
+	v.Check(bookCopy.Barcode != "", "barcode", "must be provided")
+	v.Check(len(bookCopy.Barcode) <= 100, "barcode", "must not be more than 100 bytes long")
+	v.Check(validator.PermittedValue(bookCopy.Condition, CopyConditions...), "condition", "must be one of new, good, fair, poor or damaged")
+	v.Check(len(bookCopy.Location) <= 200, "location", "must not be more than 200 bytes long")
+}
+
+type CopyModel struct {
+	DB *sql.DB
+}
+
+// copyOnLoanColumn tells whether the copies row in scope is checked out.
+const copyOnLoanColumn = `
+			EXISTS (
+				SELECT 1
+				FROM loans
+				WHERE loans.copy_id = copies.id AND loans.returned_at IS NULL
+			)`
+
+func (m CopyModel) Insert(bookCopy *Copy) error {
+	query := `
+			INSERT INTO copies (book_id, barcode, condition, location)
+			SELECT id, $2, $3, $4
+			FROM books
+			WHERE id = $1 AND deleted_at IS NULL
+			RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{bookCopy.BookID, bookCopy.Barcode, bookCopy.Condition, bookCopy.Location}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&bookCopy.ID, &bookCopy.CreatedAt, &bookCopy.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		case isUniqueViolation(err, "copies_barcode_key"):
+			return ErrDuplicateBarcode
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m CopyModel) Get(id int64) (*Copy, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	return m.get(`id = $1`, id)
+}
+
+func (m CopyModel) GetByBarcode(barcode string) (*Copy, error) {
+	return m.get(`barcode = $1`, barcode)
+}
+
+func (m CopyModel) get(condition string, arg any) (*Copy, error) {
+	query := `
+			SELECT id, book_id, barcode, condition, location, ` + copyOnLoanColumn + `, created_at, version
+			FROM copies
+			WHERE withdrawn_at IS NULL AND ` + condition
+
+	var bookCopy Copy
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, arg).Scan(
+		&bookCopy.ID,
+		&bookCopy.BookID,
+		&bookCopy.Barcode,
+		&bookCopy.Condition,
+		&bookCopy.Location,
+		&bookCopy.OnLoan,
+		&bookCopy.CreatedAt,
+		&bookCopy.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &bookCopy, nil
+}
+
+func (m CopyModel) Update(bookCopy *Copy) error {
+	query := `
+			UPDATE copies
+			SET barcode = $1, condition = $2, location = $3, version = version + 1
+			WHERE id = $4 AND version = $5 AND withdrawn_at IS NULL
+			RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{bookCopy.Barcode, bookCopy.Condition, bookCopy.Location, bookCopy.ID, bookCopy.Version}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&bookCopy.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case isUniqueViolation(err, "copies_barcode_key"):
+			return ErrDuplicateBarcode
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete withdraws a copy from the library, keeping its loan history. A copy
+// that is out on loan has to be returned first, and one kept for a hold has
+// to be picked up or the hold has to end.
+func (m CopyModel) Delete(id int64) error {
+	bookCopy, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockHoldQueue(ctx, tx, bookCopy.BookID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+			SELECT ` + copyOnLoanColumn + `, EXISTS (
+				SELECT 1
+				FROM holds
+				WHERE holds.copy_id = copies.id AND holds.status = 'ready'
+			)
+			FROM copies
+			WHERE id = $1 AND withdrawn_at IS NULL`
+
+	var onLoan, onHold bool
+
+	err = tx.QueryRowContext(ctx, query, id).Scan(&onLoan, &onHold)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	switch {
+	case onLoan:
+		return ErrCopyOnLoan
+	case onHold:
+		return ErrCopyOnHold
+	}
+
+	query = `
+			UPDATE copies
+			SET withdrawn_at = NOW(), version = version + 1
+			WHERE id = $1`
+
+	_, err = tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m CopyModel) GetAllForBook(bookID int64) ([]*Copy, error) {
+	query := `
+			SELECT id, book_id, barcode, condition, location, ` + copyOnLoanColumn + `, created_at, version
+			FROM copies
+			WHERE book_id = $1 AND withdrawn_at IS NULL
+			ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	copies := []*Copy{}
+
+	for rows.Next() {
+		var bookCopy Copy
+
+		err := rows.Scan(
+			&bookCopy.ID,
+			&bookCopy.BookID,
+			&bookCopy.Barcode,
+			&bookCopy.Condition,
+			&bookCopy.Location,
+			&bookCopy.OnLoan,
+			&bookCopy.CreatedAt,
+			&bookCopy.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		copies = append(copies, &bookCopy)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return copies, nil
+}
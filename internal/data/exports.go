@@ -0,0 +1,87 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// exportFetchSize is how many rows Export fetches from its cursor at a time.
+const exportFetchSize = 500
+
+// Export calls fn with each book matching bookFilters, in the order of
+// filters.Sort. The books are read through a server-side cursor, so only one
+// batch of them is held in memory at a time however many there are. Export
+// stops at the first error returned by fn, or when ctx is done.
+func (b BookModel) Export(ctx context.Context, bookFilters BookFilters, filters Filters, fn func(*Book) error) error {
+	qb := &queryBuilder{}
+	bookFilters.apply(qb)
+
+	columns, bookDests := selectBookColumns(bookFilters.Fields)
+
+	orderBy := fmt.Sprintf("%s %s, id ASC", filters.sortColumn(), filters.sortDirection())
+	if filters.Sort == "relevance" {
+		orderBy = fmt.Sprintf("ts_rank_cd(search_vector, websearch_to_tsquery('simple', %s)) DESC, id ASC", qb.arg(bookFilters.Query))
+	}
+
+	query := fmt.Sprintf(`
+			DECLARE book_export NO SCROLL CURSOR FOR
+			SELECT %s
+			FROM books
+			%s
+			ORDER BY %s`,
+		columns,
+		qb.whereClause(),
+		orderBy,
+	)
+
+	tx, err := b.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, query, qb.args...)
+	if err != nil {
+		return err
+	}
+
+	fetch := fmt.Sprintf("FETCH %d FROM book_export", exportFetchSize)
+	for {
+		n, err := b.exportBatch(ctx, tx, fetch, bookDests, fn)
+		if err != nil {
+			return err
+		}
+		if n < exportFetchSize {
+			break
+		}
+	}
+
+	return tx.Commit()
+}
+
+// exportBatch fetches the next batch of rows from the export cursor and
+// passes each of them to fn. It returns how many rows there were.
+func (b BookModel) exportBatch(ctx context.Context, tx *sql.Tx, fetch string, bookDests func(*Book) []any, fn func(*Book) error) (int, error) {
+	rows, err := tx.QueryContext(ctx, fetch)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		var book Book
+
+		err := rows.Scan(bookDests(&book)...)
+		if err != nil {
+			return n, err
+		}
+
+		if err = fn(&book); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
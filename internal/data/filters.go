@@ -2,7 +2,11 @@ package data
 
 import (
 	"Books/internal/validator"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"math"
+	"strconv"
 	"strings"
 )
 
@@ -11,6 +15,32 @@ type Filters struct {
 	PageSize     int
 	Sort         string
 	SortSafelist []string
+	Cursor       string
+}
+
+// cursor is the position after the last row of a page: the value of the
+// active sort column and the id tiebreaker. Cursors are handed to clients as
+// opaque base64 strings.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+func encodeCursor(c cursor) string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(js, &c)
+	return c, err
 }
 
 func (f Filters) sortColumn() string {
@@ -33,8 +63,58 @@ func (f Filters) limit() int {
 	return f.PageSize
 }
 func (f Filters) offset() int {
+	if f.Cursor != "" {
+		return 0
+	}
 	return (f.Page - 1) * f.PageSize
 }
+
+// applyCursor restricts the query to the rows after the cursor in the
+// current sort order. It does nothing when the filters are page-based. The
+// cursor must already have been checked by ValidateFilters.
+func (f Filters) applyCursor(qb *queryBuilder) {
+	if f.Cursor == "" {
+		return
+	}
+
+	c, err := decodeCursor(f.Cursor)
+	if err != nil {
+		panic("unchecked cursor: " + f.Cursor)
+	}
+
+	column := f.sortColumn()
+	op := ">"
+	if f.sortDirection() == "DESC" {
+		op = "<"
+	}
+
+	value := qb.arg(c.Value)
+	id := qb.arg(c.ID)
+	qb.where(fmt.Sprintf("(%s %s %s OR (%s = %s AND id > %s))", column, op, value, column, value, id))
+}
+
+// nextCursor encodes the position after a row with the given sort column
+// value and id.
+func (f Filters) nextCursor(value string, id int64) string {
+	return encodeCursor(cursor{Sort: f.Sort, Value: value, ID: id})
+}
+
+// validCursorValue reports whether a cursor value can be compared against the
+// given sort column: a whole number for id and pages, a finite number for
+// rating and any string for text columns such as title.
+func validCursorValue(column, value string) bool {
+	switch column {
+	case "id", "pages":
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err == nil
+	case "rating":
+		n, err := strconv.ParseFloat(value, 64)
+		return err == nil && !math.IsNaN(n) && !math.IsInf(n, 0)
+	default:
+		return true
+	}
+}
+
 func ValidateFilters(v *validator.Validator, f Filters) {
 
 	v.Check(f.Page > 0, "page", "must be greater than zero")
@@ -43,14 +123,21 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
 
 	v.Check(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+
+	if f.Cursor != "" {
+		c, err := decodeCursor(f.Cursor)
+		v.Check(err == nil && validCursorValue(strings.TrimPrefix(c.Sort, "-"), c.Value), "cursor", "invalid cursor")
+		v.Check(err != nil || c.Sort == f.Sort, "cursor", "does not match the sort parameter")
+	}
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
 }
 
 func calculateMetadata(totalRecords, page, pageSize int) Metadata {
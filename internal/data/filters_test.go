@@ -0,0 +1,107 @@
+package data
+
+import (
+	"Books/internal/validator"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []cursor{
+		{Sort: "id", Value: "42", ID: 42},
+		{Sort: "-rating", Value: "4.50", ID: 7},
+		{Sort: "title", Value: "Gödel, Escher, Bach", ID: 1},
+		{Sort: "title", Value: "", ID: 3},
+	}
+
+	for _, want := range tests {
+		got, err := decodeCursor(encodeCursor(want))
+		if err != nil {
+			t.Fatalf("decodeCursor(encodeCursor(%+v)) returned error: %v", want, err)
+		}
+		if got != want {
+			t.Errorf("got %+v; want %+v", got, want)
+		}
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	tests := []string{
+		"not base64!",
+		"bm90IGpzb24",
+		encodeCursor(cursor{})[:3] + "=",
+	}
+
+	for _, s := range tests {
+		if _, err := decodeCursor(s); err == nil {
+			t.Errorf("decodeCursor(%q) returned no error", s)
+		}
+	}
+}
+
+func TestValidateFiltersCursor(t *testing.T) {
+	tests := []struct {
+		name   string
+		sort   string
+		cursor string
+		want   string
+	}{
+		{"none", "id", "", ""},
+		{"matching", "-rating", encodeCursor(cursor{Sort: "-rating", Value: "4.50", ID: 7}), ""},
+		{"other sort", "id", encodeCursor(cursor{Sort: "-rating", Value: "4.50", ID: 7}), "does not match the sort parameter"},
+		{"garbage", "id", "not a cursor", "invalid cursor"},
+		{"text id", "id", encodeCursor(cursor{Sort: "id", Value: "abc", ID: 7}), "invalid cursor"},
+		{"fractional id", "id", encodeCursor(cursor{Sort: "id", Value: "7.5", ID: 7}), "invalid cursor"},
+		{"whole pages", "-pages", encodeCursor(cursor{Sort: "-pages", Value: "320", ID: 7}), ""},
+		{"text pages", "-pages", encodeCursor(cursor{Sort: "-pages", Value: "many", ID: 7}), "invalid cursor"},
+		{"whole rating", "-rating", encodeCursor(cursor{Sort: "-rating", Value: "4", ID: 7}), ""},
+		{"text rating", "-rating", encodeCursor(cursor{Sort: "-rating", Value: "good", ID: 7}), "invalid cursor"},
+		{"NaN rating", "-rating", encodeCursor(cursor{Sort: "-rating", Value: "NaN", ID: 7}), "invalid cursor"},
+		{"title", "title", encodeCursor(cursor{Sort: "title", Value: "Dune", ID: 7}), ""},
+		{"numeric title", "title", encodeCursor(cursor{Sort: "title", Value: "1984", ID: 7}), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateFilters(v, Filters{
+				Page:         1,
+				PageSize:     20,
+				Sort:         tt.sort,
+				SortSafelist: []string{"id", "title", "-pages", "-rating"},
+				Cursor:       tt.cursor,
+			})
+
+			if got := v.Errors["cursor"]; got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyCursor(t *testing.T) {
+	tests := []struct {
+		sort  string
+		where string
+	}{
+		{"title", "(title > $1 OR (title = $1 AND id > $2))"},
+		{"-title", "(title < $1 OR (title = $1 AND id > $2))"},
+	}
+
+	for _, tt := range tests {
+		f := Filters{
+			Sort:         tt.sort,
+			SortSafelist: []string{"title", "-title"},
+			Cursor:       encodeCursor(cursor{Sort: tt.sort, Value: "Dune", ID: 9}),
+		}
+
+		qb := &queryBuilder{}
+		f.applyCursor(qb)
+
+		if got := qb.whereClause(); got != "WHERE "+tt.where {
+			t.Errorf("sort %s: got %q; want %q", tt.sort, got, "WHERE "+tt.where)
+		}
+		if len(qb.args) != 2 || qb.args[0] != "Dune" || qb.args[1] != int64(9) {
+			t.Errorf("sort %s: got args %v", tt.sort, qb.args)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package data
+
+import (
+	"Books/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+)
+
+// Goal is the number of books a user means to read in a year. Read counts
+// the books they have finished in that year so far, and Percent is how much
+// of the goal that is, up to 100.
+type Goal struct {
+	Year      int       `json:"year"`
+	Books     int       `json:"books"`
+	Read      int       `json:"read"`
+	Percent   float64   `json:"percent"`
+	CreatedAt time.Time `json:"created_at"`
+	Version   int32     `json:"version"`
+}
+
+func (g *Goal) setPercent() {
+	g.Percent = 100
+	if g.Read < g.Books {
+		g.Percent = math.Floor(float64(g.Read)*10000/float64(g.Books)) / 100
+	}
+}
+
+func ValidateGoal(v *validator.Validator, goal *Goal) {
+	v.Check(goal.Year >= 1900 && goal.Year <= 9999, "year", "must be between 1900 and 9999")
+	v.Check(goal.Books > 0, "books", "must be greater than zero")
+	v.Check(goal.Books <= 10_000, "books", "must not be more than 10000")
+}
+
+type GoalModel struct {
+	DB *sql.DB
+}
+
+// goalReadColumn counts the books the user of the reading_goals row in scope
+// finished in its year.
+const goalReadColumn = `
+			(
+				SELECT count(*)
+				FROM reading_progress
+				WHERE reading_progress.user_id = reading_goals.user_id
+					AND extract(year FROM reading_progress.finished_at) = reading_goals.year
+			)`
+
+func (m GoalModel) Get(userID int64, year int) (*Goal, error) {
+	query := `
+			SELECT year, books, ` + goalReadColumn + `, created_at, version
+			FROM reading_goals
+			WHERE user_id = $1 AND year = $2`
+
+	var goal Goal
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, year).Scan(
+		&goal.Year,
+		&goal.Books,
+		&goal.Read,
+		&goal.CreatedAt,
+		&goal.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	goal.setPercent()
+	return &goal, nil
+}
+
+// Set sets the goal of a user for a year, replacing any goal they had for it.
+func (m GoalModel) Set(userID int64, goal *Goal) error {
+	query := `
+			INSERT INTO reading_goals (user_id, year, books)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, year) DO UPDATE
+			SET books = EXCLUDED.books, version = reading_goals.version + 1
+			RETURNING ` + goalReadColumn + `, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, goal.Year, goal.Books).Scan(&goal.Read, &goal.CreatedAt, &goal.Version)
+	if err != nil {
+		return err
+	}
+	goal.setPercent()
+	return nil
+}
+
+func (m GoalModel) Delete(userID int64, year int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM reading_goals WHERE user_id = $1 AND year = $2`, userID, year)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,407 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrDuplicateHold = errors.New("duplicate hold")
+	ErrNoCopies      = errors.New("no copies")
+	ErrCopyAvailable = errors.New("copy available")
+	ErrCopyOnHold    = errors.New("copy on hold")
+)
+
+// The statuses of a hold. A hold waits in the queue for its book until a copy
+// comes back, and is then ready for pickup until it expires. Checking out the
+// copy fulfils it.
+const (
+	HoldWaiting   = "waiting"
+	HoldReady     = "ready"
+	HoldFulfilled = "fulfilled"
+	HoldExpired   = "expired"
+	HoldCancelled = "cancelled"
+)
+
+// Hold is the place of a user in the queue for a book. Position counts from 1
+// at the head of the queue while the hold is waiting. CopyID is the copy kept
+// for the user once the hold is ready.
+type Hold struct {
+	ID        int64      `json:"id"`
+	BookID    int64      `json:"book_id"`
+	UserID    int64      `json:"user_id"`
+	Status    string     `json:"status"`
+	Position  int        `json:"position,omitempty"`
+	CopyID    *int64     `json:"copy_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadyAt   *time.Time `json:"ready_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	Version   int32      `json:"version"`
+}
+
+// ReadyHold is a hold that has just become ready, along with what it takes to
+// tell the user to come and pick the copy up.
+type ReadyHold struct {
+	Hold
+	Title   string `json:"title"`
+	Barcode string `json:"barcode"`
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+}
+
+type HoldModel struct {
+	DB *sql.DB
+}
+
+// holdColumns are the columns of a Hold, from the holds table.
+const holdColumns = `holds.id, holds.book_id, holds.user_id, holds.status,
+				CASE WHEN holds.status = 'waiting' THEN (
+					SELECT count(*)
+					FROM holds AS ahead
+					WHERE ahead.book_id = holds.book_id AND ahead.status = 'waiting' AND ahead.id <= holds.id
+				) ELSE 0 END,
+				holds.copy_id, holds.created_at, holds.ready_at, holds.expires_at, holds.version`
+
+func holdDests(hold *Hold) []any {
+	return []any{
+		&hold.ID,
+		&hold.BookID,
+		&hold.UserID,
+		&hold.Status,
+		&hold.Position,
+		&hold.CopyID,
+		&hold.CreatedAt,
+		&hold.ReadyAt,
+		&hold.ExpiresAt,
+		&hold.Version,
+	}
+}
+
+// lockHoldQueue locks the row of a book for the rest of tx. Every change to
+// the holds, loans and copies of a book takes this lock first, so the queue
+// for the book is only ever changed by one transaction at a time, however
+// many copies come back at once. Books in the trash are locked too, since
+// their copies can still be returned.
+func lockHoldQueue(ctx context.Context, tx *sql.Tx, bookID int64) error {
+	err := tx.QueryRowContext(ctx, `SELECT id FROM books WHERE id = $1 FOR NO KEY UPDATE`, bookID).Scan(&bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// passCopyOn keeps a copy that has become free for the hold at the head of
+// the queue for its book, for pickupWindow. It returns nil when nobody is
+// waiting. The caller must hold the lock on the queue.
+func passCopyOn(ctx context.Context, tx *sql.Tx, copyID int64, pickupWindow time.Duration) (*ReadyHold, error) {
+	query := `
+			WITH next AS (
+				SELECT holds.id
+				FROM holds
+				INNER JOIN copies ON copies.book_id = holds.book_id
+				WHERE copies.id = $1 AND holds.status = 'waiting'
+				ORDER BY holds.id ASC
+				LIMIT 1
+				FOR UPDATE OF holds
+			), ready AS (
+				UPDATE holds
+				SET status = 'ready',
+					copy_id = $1,
+					ready_at = NOW(),
+					expires_at = NOW() + $2::double precision * interval '1 second',
+					version = version + 1
+				FROM next
+				WHERE holds.id = next.id
+				RETURNING holds.*
+			)
+			SELECT ready.id, ready.book_id, ready.user_id, ready.status, 0, ready.copy_id, ready.created_at,
+				ready.ready_at, ready.expires_at, ready.version, books.title, copies.barcode, users.name, users.email
+			FROM ready
+			INNER JOIN books ON books.id = ready.book_id
+			INNER JOIN copies ON copies.id = ready.copy_id
+			INNER JOIN users ON users.id = ready.user_id`
+
+	var hold ReadyHold
+
+	dests := append(holdDests(&hold.Hold), &hold.Title, &hold.Barcode, &hold.Name, &hold.Email)
+	err := tx.QueryRowContext(ctx, query, copyID, pickupWindow.Seconds()).Scan(dests...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+	return &hold, nil
+}
+
+// Insert puts a user in the queue for a book. Holds are only taken while
+// every copy of the book is either on loan or kept for somebody else.
+func (m HoldModel) Insert(hold *Hold) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockHoldQueue(ctx, tx, hold.BookID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+			SELECT count(*), count(*) FILTER (
+				WHERE NOT ` + copyOnLoanColumn + `
+				AND NOT EXISTS (
+					SELECT 1
+					FROM holds
+					WHERE holds.copy_id = copies.id AND holds.status = 'ready'
+				)
+			)
+			FROM copies
+			WHERE book_id = $1 AND withdrawn_at IS NULL`
+
+	var copies, available int
+
+	err = tx.QueryRowContext(ctx, query, hold.BookID).Scan(&copies, &available)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case copies == 0:
+		return ErrNoCopies
+	case available > 0:
+		return ErrCopyAvailable
+	}
+
+	query = `
+			INSERT INTO holds (book_id, user_id)
+			VALUES ($1, $2)
+			RETURNING id`
+
+	err = tx.QueryRowContext(ctx, query, hold.BookID, hold.UserID).Scan(&hold.ID)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err, "holds_book_id_user_id_active_key"):
+			return ErrDuplicateHold
+		default:
+			return err
+		}
+	}
+
+	query = `
+			SELECT ` + holdColumns + `
+			FROM holds
+			WHERE holds.id = $1`
+
+	err = tx.QueryRowContext(ctx, query, hold.ID).Scan(holdDests(hold)...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m HoldModel) Get(id int64) (*Hold, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+			SELECT ` + holdColumns + `
+			FROM holds
+			WHERE holds.id = $1`
+
+	var hold Hold
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(holdDests(&hold)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &hold, nil
+}
+
+// GetActiveForUser lists the holds of a user that are waiting or ready, in
+// the order they were placed.
+func (m HoldModel) GetActiveForUser(userID int64) ([]*Hold, error) {
+	query := `
+			SELECT ` + holdColumns + `
+			FROM holds
+			WHERE holds.user_id = $1 AND holds.status IN ('waiting', 'ready')
+			ORDER BY holds.id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holds := []*Hold{}
+
+	for rows.Next() {
+		var hold Hold
+
+		err := rows.Scan(holdDests(&hold)...)
+		if err != nil {
+			return nil, err
+		}
+		holds = append(holds, &hold)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return holds, nil
+}
+
+// Cancel takes a waiting or ready hold out of the queue. The copy kept for a
+// ready hold goes to the next hold in the queue, which is returned.
+func (m HoldModel) Cancel(hold *Hold, pickupWindow time.Duration) (*ReadyHold, error) {
+	return m.end(hold, HoldCancelled, `status IN ('waiting', 'ready')`, pickupWindow)
+}
+
+// Expire ends a ready hold whose copy hasn't been picked up in time, passing
+// the copy on to the next hold in the queue, which is returned. A hold that
+// has been collected or cancelled in the meantime is left alone.
+func (m HoldModel) Expire(hold *Hold, pickupWindow time.Duration) (*ReadyHold, error) {
+	return m.end(hold, HoldExpired, `status = 'ready' AND expires_at < NOW()`, pickupWindow)
+}
+
+func (m HoldModel) end(hold *Hold, status, condition string, pickupWindow time.Duration) (*ReadyHold, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = lockHoldQueue(ctx, tx, hold.BookID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+			WITH ended AS (
+				SELECT id, status, copy_id
+				FROM holds
+				WHERE id = $2 AND version = $3 AND ` + condition + `
+			)
+			UPDATE holds
+			SET status = $1, version = holds.version + 1
+			FROM ended
+			WHERE holds.id = ended.id
+			RETURNING ended.status, ended.copy_id, holds.version`
+
+	var (
+		previous string
+		copyID   *int64
+	)
+
+	err = tx.QueryRowContext(ctx, query, status, hold.ID, hold.Version).Scan(&previous, &copyID, &hold.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrEditConflict
+		default:
+			return nil, err
+		}
+	}
+	hold.Status = status
+	hold.Position = 0
+
+	var next *ReadyHold
+	if previous == HoldReady && copyID != nil {
+		next, err = passCopyOn(ctx, tx, *copyID, pickupWindow)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return next, tx.Commit()
+}
+
+// AssignCopy offers a copy that has just been added to the library to the
+// head of the queue for its book, if anybody is waiting.
+func (m HoldModel) AssignCopy(bookCopy *Copy, pickupWindow time.Duration) (*ReadyHold, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = lockHoldQueue(ctx, tx, bookCopy.BookID)
+	if err != nil {
+		return nil, err
+	}
+
+	hold, err := passCopyOn(ctx, tx, bookCopy.ID, pickupWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	return hold, tx.Commit()
+}
+
+// GetExpired returns up to limit of the ready holds whose pickup window has
+// passed.
+func (m HoldModel) GetExpired(limit int) ([]*Hold, error) {
+	query := `
+			SELECT ` + holdColumns + `
+			FROM holds
+			WHERE holds.status = 'ready' AND holds.expires_at < NOW()
+			ORDER BY holds.expires_at ASC
+			LIMIT $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holds := []*Hold{}
+
+	for rows.Next() {
+		var hold Hold
+
+		err := rows.Scan(holdDests(&hold)...)
+		if err != nil {
+			return nil, err
+		}
+		holds = append(holds, &hold)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return holds, nil
+}
@@ -0,0 +1,271 @@
+package data
+
+import (
+	"context"
+	"github.com/lib/pq"
+	"strings"
+	"time"
+)
+
+// ExistingISBN13s maps those of the given ISBN-13s that already belong to a
+// book to the ID of that book, including the books in the trash.
+func (b BookModel) ExistingISBN13s(isbns []string) (map[string]int64, error) {
+	query := `
+			SELECT isbn13, id
+			FROM books
+			WHERE isbn13 = ANY($1) AND isbn13 <> ''`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := b.DB.QueryContext(ctx, query, pq.Array(isbns))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := map[string]int64{}
+
+	for rows.Next() {
+		var isbn13 string
+		var id int64
+
+		err := rows.Scan(&isbn13, &id)
+		if err != nil {
+			return nil, err
+		}
+		existing[isbn13] = id
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// InsertBatch inserts books in a single transaction, streaming them into
+// Postgres with COPY. Books it has to skip are left out of the batch rather
+// than failing it: the returned map holds the index of each of them and why,
+// either ErrUnknownAuthor or ErrDuplicateISBN. The books that were inserted
+// get their ID, creation time and version set.
+func (b BookModel) InsertBatch(books []*Book, userID int64) (map[int]error, error) {
+	skipped := map[int]error{}
+	if len(books) == 0 {
+		return skipped, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := b.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Look up the authors referenced by ID and create the ones referenced by
+	// name, two queries for the whole batch.
+	var ids []int64
+	var names []string
+	for _, book := range books {
+		for _, author := range book.Authors {
+			if author.ID != 0 {
+				ids = append(ids, author.ID)
+			} else {
+				names = append(names, strings.TrimSpace(author.Name))
+			}
+		}
+	}
+
+	byID := map[int64]string{}
+	if len(ids) > 0 {
+		rows, err := tx.QueryContext(ctx, `SELECT id, name FROM authors WHERE id = ANY($1)`, pq.Array(ids))
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id int64
+			var name string
+			if err := rows.Scan(&id, &name); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			byID[id] = name
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	byName := map[string]int64{}
+	canonical := map[string]string{}
+	if len(names) > 0 {
+		query := `
+				INSERT INTO authors (name)
+				SELECT DISTINCT unnest($1::citext[])
+				ON CONFLICT (name) DO UPDATE SET name = authors.name
+				RETURNING id, name`
+
+		rows, err := tx.QueryContext(ctx, query, pq.Array(names))
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id int64
+			var name string
+			if err := rows.Scan(&id, &name); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			byName[strings.ToLower(name)] = id
+			canonical[strings.ToLower(name)] = name
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, book := range books {
+		for j := range book.Authors {
+			author := &book.Authors[j]
+			if author.Role == "" {
+				author.Role = RoleAuthor
+			}
+
+			if author.ID != 0 {
+				name, ok := byID[author.ID]
+				if !ok {
+					skipped[i] = ErrUnknownAuthor
+					break
+				}
+				author.Name = name
+				continue
+			}
+
+			key := strings.ToLower(strings.TrimSpace(author.Name))
+			author.ID, author.Name = byName[key], canonical[key]
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+			CREATE TEMPORARY TABLE book_import (
+				n integer,
+				title text,
+				authors text,
+				rating double precision,
+				pages integer,
+				genres text[],
+				isbn text,
+				isbn13 text,
+				language text,
+				description text
+			) ON COMMIT DROP`)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("book_import", "n", "title", "authors", "rating", "pages", "genres", "isbn", "isbn13", "language", "description"))
+	if err != nil {
+		return nil, err
+	}
+
+	for i, book := range books {
+		if skipped[i] != nil {
+			continue
+		}
+
+		genres, err := pq.Array(book.Genres).Value()
+		if err != nil {
+			stmt.Close()
+			return nil, err
+		}
+
+		_, err = stmt.ExecContext(ctx, i, book.Title, book.Authors.Names(), book.Rating, int32(book.Pages), genres, book.ISBN, book.ISBN13, book.Language, book.Description)
+		if err != nil {
+			stmt.Close()
+			return nil, err
+		}
+	}
+
+	if _, err = stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return nil, err
+	}
+	if err = stmt.Close(); err != nil {
+		return nil, err
+	}
+
+	// Books whose ISBN-13 is taken, by an existing book or an earlier one in
+	// the batch, are not inserted and so not returned.
+	query := `
+			INSERT INTO books (title, authors, rating, pages, genres, isbn, isbn13, language, description)
+			SELECT title, authors, rating, pages, genres, isbn, isbn13, language, description
+			FROM book_import
+			ORDER BY n
+			ON CONFLICT (isbn13) WHERE isbn13 <> '' DO NOTHING
+			RETURNING id, isbn13, created_at, version`
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	inserted := map[string]*Book{}
+	for rows.Next() {
+		var book Book
+		if err := rows.Scan(&book.ID, &book.ISBN13, &book.CreatedAt, &book.Version); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		inserted[book.ISBN13] = &book
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var insertedIDs, bookIDs, authorIDs []int64
+	var positions []int32
+	var roles []string
+	for i, book := range books {
+		if skipped[i] != nil {
+			continue
+		}
+
+		row, ok := inserted[book.ISBN13]
+		if !ok || row.ID == 0 {
+			skipped[i] = ErrDuplicateISBN
+			continue
+		}
+		book.ID, book.CreatedAt, book.Version = row.ID, row.CreatedAt, row.Version
+		insertedIDs = append(insertedIDs, book.ID)
+		// A later duplicate in the batch must not claim the same row.
+		row.ID = 0
+
+		for j, author := range book.Authors {
+			bookIDs = append(bookIDs, book.ID)
+			authorIDs = append(authorIDs, author.ID)
+			positions = append(positions, int32(j+1))
+			roles = append(roles, author.Role)
+		}
+	}
+
+	query = `
+			INSERT INTO book_authors (book_id, author_id, position, role)
+			SELECT * FROM unnest($1::bigint[], $2::bigint[], $3::integer[], $4::text[])
+			ON CONFLICT DO NOTHING`
+
+	_, err = tx.ExecContext(ctx, query, pq.Array(bookIDs), pq.Array(authorIDs), pq.Array(positions), pq.Array(roles))
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertBookRevisions(ctx, tx, userID, insertedIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	return skipped, tx.Commit()
+}
@@ -0,0 +1,360 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Loan is the checkout of a copy by a user. A loan is active until the copy
+// is returned, and overdue while it is active past its due date.
+type Loan struct {
+	ID           int64      `json:"id"`
+	CopyID       int64      `json:"copy_id"`
+	BookID       int64      `json:"book_id"`
+	UserID       int64      `json:"user_id"`
+	CheckedOutAt time.Time  `json:"checked_out_at"`
+	DueAt        time.Time  `json:"due_at"`
+	Renewals     int        `json:"renewals"`
+	ReturnedAt   *time.Time `json:"returned_at"`
+	Version      int32      `json:"version"`
+}
+
+// OverdueLoan is an overdue loan along with what it takes to chase it up.
+type OverdueLoan struct {
+	Loan
+	Title   string `json:"title"`
+	Barcode string `json:"barcode"`
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+}
+
+type LoanModel struct {
+	DB *sql.DB
+}
+
+// loanColumns are the columns of a Loan, from loans joined with copies.
+const loanColumns = `loans.id, loans.copy_id, copies.book_id, loans.user_id, loans.checked_out_at,
+				loans.due_at, loans.renewals, loans.returned_at, loans.version`
+
+func loanDests(loan *Loan) []any {
+	return []any{
+		&loan.ID,
+		&loan.CopyID,
+		&loan.BookID,
+		&loan.UserID,
+		&loan.CheckedOutAt,
+		&loan.DueAt,
+		&loan.Renewals,
+		&loan.ReturnedAt,
+		&loan.Version,
+	}
+}
+
+// Checkout lends a copy to a user. The database allows one active loan per
+// copy, so a copy that is already out gives ErrCopyOnLoan. A copy kept for
+// somebody else's hold gives ErrCopyOnHold, while checking out the copy kept
+// for the borrower fulfils their hold. A copy withdrawn in the meantime gives
+// ErrRecordNotFound.
+func (m LoanModel) Checkout(loan *Loan) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockHoldQueue(ctx, tx, loan.BookID)
+	if err != nil {
+		return err
+	}
+
+	var heldFor int64
+	err = tx.QueryRowContext(ctx, `SELECT user_id FROM holds WHERE copy_id = $1 AND status = 'ready'`, loan.CopyID).Scan(&heldFor)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err == nil && heldFor != loan.UserID {
+		return ErrCopyOnHold
+	}
+
+	query := `
+			INSERT INTO loans (copy_id, user_id, due_at)
+			SELECT id, $2, $3
+			FROM copies
+			WHERE id = $1 AND withdrawn_at IS NULL
+			RETURNING id, checked_out_at, renewals, version`
+
+	args := []any{loan.CopyID, loan.UserID, loan.DueAt}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&loan.ID, &loan.CheckedOutAt, &loan.Renewals, &loan.Version)
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		case isUniqueViolation(err, "loans_copy_id_active_key"):
+			return ErrCopyOnLoan
+		case errors.As(err, &pqErr) && pqErr.Code == "23503":
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	// A copy kept for the borrower on another ready hold stays kept until
+	// that hold expires and passes it on.
+	query = `
+			UPDATE holds
+			SET status = 'fulfilled', version = version + 1
+			WHERE book_id = $1 AND user_id = $2 AND (status = 'waiting' OR (status = 'ready' AND copy_id = $3))`
+
+	_, err = tx.ExecContext(ctx, query, loan.BookID, loan.UserID, loan.CopyID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m LoanModel) Get(id int64) (*Loan, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+			SELECT ` + loanColumns + `
+			FROM loans
+			INNER JOIN copies ON copies.id = loans.copy_id
+			WHERE loans.id = $1`
+
+	var loan Loan
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(loanDests(&loan)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &loan, nil
+}
+
+// Return ends an active loan. The copy goes to the hold at the head of the
+// queue for the book, if there is one, which is returned so that the user
+// can be told to come and pick it up.
+func (m LoanModel) Return(loan *Loan, pickupWindow time.Duration) (*ReadyHold, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = lockHoldQueue(ctx, tx, loan.BookID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+			UPDATE loans
+			SET returned_at = NOW(), version = version + 1
+			WHERE id = $1 AND version = $2 AND returned_at IS NULL
+			RETURNING returned_at, version`
+
+	err = tx.QueryRowContext(ctx, query, loan.ID, loan.Version).Scan(&loan.ReturnedAt, &loan.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrEditConflict
+		default:
+			return nil, err
+		}
+	}
+
+	hold, err := passCopyOn(ctx, tx, loan.CopyID, pickupWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	return hold, tx.Commit()
+}
+
+// Renew moves the due date of an active loan to dueAt.
+func (m LoanModel) Renew(loan *Loan, dueAt time.Time) error {
+	query := `
+			UPDATE loans
+			SET due_at = $1, renewals = renewals + 1, reminded_at = NULL, version = version + 1
+			WHERE id = $2 AND version = $3 AND returned_at IS NULL
+			RETURNING due_at, renewals, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, dueAt, loan.ID, loan.Version).Scan(&loan.DueAt, &loan.Renewals, &loan.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAllForUser lists the loans of a user, newest first. Active leaves out
+// the returned loans when true.
+func (m LoanModel) GetAllForUser(userID int64, active bool, filters Filters) ([]*Loan, Metadata, error) {
+	qb := &queryBuilder{}
+	qb.where("loans.user_id = " + qb.arg(userID))
+	if active {
+		qb.where("loans.returned_at IS NULL")
+	}
+
+	query := fmt.Sprintf(`
+			SELECT count(*) OVER(), %s
+			FROM loans
+			INNER JOIN copies ON copies.id = loans.copy_id
+			%s
+			ORDER BY loans.%s %s, loans.id DESC
+			LIMIT %s OFFSET %s`,
+		loanColumns,
+		qb.whereClause(),
+		filters.sortColumn(),
+		filters.sortDirection(),
+		qb.arg(filters.limit()),
+		qb.arg(filters.offset()),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, qb.args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	loans := []*Loan{}
+
+	for rows.Next() {
+		var loan Loan
+
+		err := rows.Scan(append([]any{&totalRecords}, loanDests(&loan)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		loans = append(loans, &loan)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return loans, metadata, nil
+}
+
+// overdueQuery selects the overdue loans matching the given conditions, most
+// overdue first.
+const overdueQuery = `
+			SELECT %s` + loanColumns + `, books.title, copies.barcode, users.name, users.email
+			FROM loans
+			INNER JOIN copies ON copies.id = loans.copy_id
+			INNER JOIN books ON books.id = copies.book_id
+			INNER JOIN users ON users.id = loans.user_id
+			WHERE loans.returned_at IS NULL AND loans.due_at < NOW() %s
+			ORDER BY loans.due_at ASC, loans.id ASC
+			%s`
+
+func overdueDests(loan *OverdueLoan) []any {
+	return append(loanDests(&loan.Loan), &loan.Title, &loan.Barcode, &loan.Name, &loan.Email)
+}
+
+func (m LoanModel) GetOverdue(filters Filters) ([]*OverdueLoan, Metadata, error) {
+	query := fmt.Sprintf(overdueQuery, "count(*) OVER(), ", "", "LIMIT $1 OFFSET $2")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	loans := []*OverdueLoan{}
+
+	for rows.Next() {
+		var loan OverdueLoan
+
+		err := rows.Scan(append([]any{&totalRecords}, overdueDests(&loan)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		loans = append(loans, &loan)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return loans, metadata, nil
+}
+
+// GetDueReminders returns up to limit of the overdue loans whose borrowers
+// haven't been reminded about them within the last interval.
+func (m LoanModel) GetDueReminders(interval time.Duration, limit int) ([]*OverdueLoan, error) {
+	query := fmt.Sprintf(overdueQuery,
+		"",
+		"AND (loans.reminded_at IS NULL OR loans.reminded_at < NOW() - $1::double precision * interval '1 second')",
+		"LIMIT $2",
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, interval.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	loans := []*OverdueLoan{}
+
+	for rows.Next() {
+		var loan OverdueLoan
+
+		err := rows.Scan(overdueDests(&loan)...)
+		if err != nil {
+			return nil, err
+		}
+		loans = append(loans, &loan)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return loans, nil
+}
+
+// MarkReminded notes that the borrower of a loan has just been reminded.
+func (m LoanModel) MarkReminded(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `UPDATE loans SET reminded_at = NOW() WHERE id = $1`, id)
+	return err
+}
@@ -3,6 +3,7 @@ package data
 import (
 	"database/sql"
 	"errors"
+	"github.com/lib/pq"
 )
 
 var (
@@ -11,15 +12,44 @@ var (
 )
 
 type Models struct {
-	Books  BookModel
-	Users  UserModel
-	Tokens TokenModel
+	Books       BookModel
+	Users       UserModel
+	Tokens      TokenModel
+	Permissions PermissionModel
+	Authors     AuthorModel
+	Revisions   BookRevisionModel
+	Search      SearchModel
+	Shelves     ShelfModel
+	Reviews     ReviewModel
+	Progress    ProgressModel
+	Stats       StatsModel
+	Goals       GoalModel
+	Copies      CopyModel
+	Loans       LoanModel
+	Holds       HoldModel
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Books:  BookModel{DB: db},
-		Users:  UserModel{DB: db},
-		Tokens: TokenModel{DB: db},
+		Books:       BookModel{DB: db},
+		Users:       UserModel{DB: db},
+		Tokens:      TokenModel{DB: db},
+		Permissions: PermissionModel{DB: db},
+		Authors:     AuthorModel{DB: db},
+		Revisions:   BookRevisionModel{DB: db},
+		Search:      SearchModel{DB: db},
+		Shelves:     ShelfModel{DB: db},
+		Reviews:     ReviewModel{DB: db},
+		Progress:    ProgressModel{DB: db},
+		Stats:       StatsModel{DB: db},
+		Goals:       GoalModel{DB: db},
+		Copies:      CopyModel{DB: db},
+		Loans:       LoanModel{DB: db},
+		Holds:       HoldModel{DB: db},
 	}
 }
+
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
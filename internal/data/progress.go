@@ -0,0 +1,240 @@
+package data
+
+import (
+	"Books/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Progress is how far a user has got with a book. It is recorded either as
+// the current page, from which Percent is worked out, or as Percent alone for
+// books without a page count. The dates are calendar dates in UTC.
+type Progress struct {
+	BookID     int64      `json:"book_id"`
+	UserID     int64      `json:"-"`
+	Page       *int32     `json:"page"`
+	Percent    float64    `json:"percent"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Version    int32      `json:"version"`
+}
+
+// SetPage records the current page of a book with the given page count.
+func (p *Progress) SetPage(page int32, pages Pages) {
+	p.Page = &page
+	if pages > 0 {
+		p.Percent = math.Floor(float64(page)*10000/float64(pages)) / 100
+	}
+}
+
+// SetPercent records progress as a percentage, forgetting the current page.
+func (p *Progress) SetPercent(percent float64) {
+	p.Page = nil
+	p.Percent = percent
+}
+
+func ValidateProgress(v *validator.Validator, progress *Progress, pages Pages) {
+	if progress.Page != nil {
+		v.Check(pages > 0, "page", "can't be recorded for a book without a page count")
+		v.Check(*progress.Page >= 0, "page", "must not be negative")
+		v.Check(*progress.Page <= int32(pages), "page", fmt.Sprintf("must not be more than %d", pages))
+	}
+	v.Check(progress.Percent >= 0 && progress.Percent <= 100, "percent", "must be between 0 and 100")
+
+	today := time.Now().UTC()
+	if progress.StartedAt != nil {
+		v.Check(!progress.StartedAt.After(today), "started_at", "must not be in the future")
+	}
+	if progress.FinishedAt != nil {
+		v.Check(!progress.FinishedAt.After(today), "finished_at", "must not be in the future")
+		v.Check(progress.StartedAt == nil || !progress.FinishedAt.Before(*progress.StartedAt), "finished_at", "must not be before started_at")
+	}
+}
+
+type ProgressModel struct {
+	DB *sql.DB
+}
+
+func (m ProgressModel) Get(userID, bookID int64) (*Progress, error) {
+	if bookID < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+			SELECT book_id, user_id, page, percent, started_at, finished_at, updated_at, version
+			FROM reading_progress
+			WHERE user_id = $1 AND book_id = $2`
+
+	var progress Progress
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, bookID).Scan(
+		&progress.BookID,
+		&progress.UserID,
+		&progress.Page,
+		&progress.Percent,
+		&progress.StartedAt,
+		&progress.FinishedAt,
+		&progress.UpdatedAt,
+		&progress.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &progress, nil
+}
+
+// Save records progress on a book, creating the record when its Version is
+// zero. Today is noted as a reading day of the user for their streaks.
+func (m ProgressModel) Save(progress *Progress) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+			INSERT INTO reading_progress (user_id, book_id, page, percent, started_at, finished_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (user_id, book_id) DO UPDATE
+			SET page = EXCLUDED.page,
+				percent = EXCLUDED.percent,
+				started_at = EXCLUDED.started_at,
+				finished_at = EXCLUDED.finished_at,
+				updated_at = NOW(),
+				version = reading_progress.version + 1
+			WHERE reading_progress.version = $7
+			RETURNING updated_at, version`
+
+	args := []any{
+		progress.UserID,
+		progress.BookID,
+		progress.Page,
+		progress.Percent,
+		progress.StartedAt,
+		progress.FinishedAt,
+		progress.Version,
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&progress.UpdatedAt, &progress.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	query = `
+			INSERT INTO reading_days (user_id, day)
+			VALUES ($1, (NOW() AT TIME ZONE 'UTC')::date)
+			ON CONFLICT DO NOTHING`
+
+	_, err = tx.ExecContext(ctx, query, progress.UserID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m ProgressModel) Delete(userID, bookID int64) error {
+	if bookID < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM reading_progress WHERE user_id = $1 AND book_id = $2`, userID, bookID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAllForUser lists the progress a user has recorded. Finished leaves out
+// the books the user has finished when false, and all others when true; nil
+// lists both.
+func (m ProgressModel) GetAllForUser(userID int64, finished *bool, filters Filters) ([]*Progress, Metadata, error) {
+	qb := &queryBuilder{}
+	qb.where("user_id = " + qb.arg(userID))
+	if finished != nil {
+		qb.where(fmt.Sprintf("(finished_at IS NOT NULL) = %s", qb.arg(*finished)))
+	}
+
+	query := fmt.Sprintf(`
+			SELECT count(*) OVER(), book_id, user_id, page, percent, started_at, finished_at, updated_at, version
+			FROM reading_progress
+			%s
+			ORDER BY %s %s NULLS LAST, book_id ASC
+			LIMIT %s OFFSET %s`,
+		qb.whereClause(),
+		filters.sortColumn(),
+		filters.sortDirection(),
+		qb.arg(filters.limit()),
+		qb.arg(filters.offset()),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, qb.args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	progresses := []*Progress{}
+
+	for rows.Next() {
+		var progress Progress
+
+		err := rows.Scan(
+			&totalRecords,
+			&progress.BookID,
+			&progress.UserID,
+			&progress.Page,
+			&progress.Percent,
+			&progress.StartedAt,
+			&progress.FinishedAt,
+			&progress.UpdatedAt,
+			&progress.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		progresses = append(progresses, &progress)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return progresses, metadata, nil
+}
@@ -0,0 +1,33 @@
+package data
+
+import (
+	"strconv"
+	"strings"
+)
+
+// queryBuilder collects the conditions of a WHERE clause together with their
+// arguments. Values only ever reach the database as arguments; arg hands out
+// the numbered placeholder to use for each one.
+type queryBuilder struct {
+	conditions []string
+	args       []any
+}
+
+// arg adds value to the query arguments and returns its placeholder.
+func (qb *queryBuilder) arg(value any) string {
+	qb.args = append(qb.args, value)
+	return "$" + strconv.Itoa(len(qb.args))
+}
+
+// where adds a condition that must hold for every row.
+func (qb *queryBuilder) where(condition string) {
+	qb.conditions = append(qb.conditions, condition)
+}
+
+// whereClause joins the conditions with AND.
+func (qb *queryBuilder) whereClause() string {
+	if len(qb.conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(qb.conditions, "\n\t\t\tAND ")
+}
@@ -0,0 +1,337 @@
+package data
+
+import (
+	"Books/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"time"
+)
+
+var (
+	ErrDuplicateReview = errors.New("duplicate review")
+)
+
+type Review struct {
+	ID        int64     `json:"id"`
+	BookID    int64     `json:"book_id"`
+	UserID    int64     `json:"user_id"`
+	Score     int       `json:"score"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int32     `json:"version"`
+}
+
+func ValidateReview(v *validator.Validator, review *Review) {
+	v.Check(review.Score >= 1 && review.Score <= 5, "score", "must be between 1 and 5")
+	v.Check(len(review.Body) <= 10_000, "body", "must not be more than 10000 bytes long")
+}
+
+type ReviewModel struct {
+	DB *sql.DB
+}
+
+// lockBook locks the row of a book that isn't in the trash for the rest of
+// tx. Review changes take this lock before touching the reviews of the book,
+// so that refreshBookRating always sees the reviews of the transactions that
+// went before it.
+func lockBook(ctx context.Context, tx *sql.Tx, bookID int64) error {
+	query := `
+			SELECT id
+			FROM books
+			WHERE id = $1 AND deleted_at IS NULL
+			FOR UPDATE`
+
+	err := tx.QueryRowContext(ctx, query, bookID).Scan(&bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshBookRating recomputes the rating of a book as the average score of
+// its reviews. A book that has never been reviewed keeps the rating it was
+// given before reviews existed. It doesn't bump the version of the book: the
+// rating isn't something editors can change, so it mustn't cause their edits
+// to conflict. The entity tag of the book covers the rating instead.
+func refreshBookRating(ctx context.Context, tx *sql.Tx, bookID int64) error {
+	query := `
+			UPDATE books
+			SET rating = CASE
+					WHEN aggregate.count > 0 THEN aggregate.rating
+					WHEN books.rating_count > 0 THEN 0
+					ELSE books.rating
+				END,
+				rating_count = aggregate.count
+			FROM (
+				SELECT avg(score) AS rating, count(*) AS count
+				FROM reviews
+				WHERE book_id = $1
+			) AS aggregate
+			WHERE books.id = $1`
+
+	_, err := tx.ExecContext(ctx, query, bookID)
+	return err
+}
+
+func (m ReviewModel) Insert(review *Review) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockBook(ctx, tx, review.BookID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+			INSERT INTO reviews (book_id, user_id, score, body)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, created_at, updated_at, version`
+
+	args := []any{review.BookID, review.UserID, review.Score, review.Body}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&review.ID, &review.CreatedAt, &review.UpdatedAt, &review.Version)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err, "reviews_book_id_user_id_key"):
+			return ErrDuplicateReview
+		default:
+			return err
+		}
+	}
+
+	err = refreshBookRating(ctx, tx, review.BookID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m ReviewModel) Get(bookID, id int64) (*Review, error) {
+	if bookID < 1 || id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+			SELECT id, book_id, user_id, score, body, created_at, updated_at, version
+			FROM reviews
+			WHERE book_id = $1 AND id = $2`
+
+	var review Review
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, bookID, id).Scan(
+		&review.ID,
+		&review.BookID,
+		&review.UserID,
+		&review.Score,
+		&review.Body,
+		&review.CreatedAt,
+		&review.UpdatedAt,
+		&review.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &review, nil
+}
+
+func (m ReviewModel) Update(review *Review) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockBook(ctx, tx, review.BookID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+			UPDATE reviews
+			SET score = $1, body = $2, updated_at = NOW(), version = version + 1
+			WHERE id = $3 AND version = $4
+			RETURNING updated_at, version`
+
+	args := []any{review.Score, review.Body, review.ID, review.Version}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&review.UpdatedAt, &review.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	err = refreshBookRating(ctx, tx, review.BookID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m ReviewModel) Delete(bookID, id int64) error {
+	if bookID < 1 || id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockBook(ctx, tx, bookID)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM reviews WHERE book_id = $1 AND id = $2`, bookID, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	err = refreshBookRating(ctx, tx, bookID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m ReviewModel) GetAllForBook(bookID int64, filters Filters) ([]*Review, Metadata, error) {
+	query := fmt.Sprintf(`
+			SELECT count(*) OVER(), id, book_id, user_id, score, body, created_at, updated_at, version
+			FROM reviews
+			WHERE book_id = $1
+			ORDER BY %s %s, id ASC
+			LIMIT $2 OFFSET $3`,
+		filters.sortColumn(),
+		filters.sortDirection(),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, bookID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	reviews := []*Review{}
+
+	for rows.Next() {
+		var review Review
+
+		err := rows.Scan(
+			&totalRecords,
+			&review.ID,
+			&review.BookID,
+			&review.UserID,
+			&review.Score,
+			&review.Body,
+			&review.CreatedAt,
+			&review.UpdatedAt,
+			&review.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		reviews = append(reviews, &review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return reviews, metadata, nil
+}
+
+// GetLatestForBooks returns up to limit of the most recent reviews of each of
+// the given books, newest first, keyed by book ID.
+func (m ReviewModel) GetLatestForBooks(bookIDs []int64, limit int) (map[int64][]*Review, error) {
+	query := `
+			SELECT id, book_id, user_id, score, body, created_at, updated_at, version
+			FROM (
+				SELECT *, row_number() OVER (PARTITION BY book_id ORDER BY id DESC) AS n
+				FROM reviews
+				WHERE book_id = ANY($1)
+			) AS latest
+			WHERE n <= $2
+			ORDER BY book_id, id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(bookIDs), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := make(map[int64][]*Review, len(bookIDs))
+
+	for rows.Next() {
+		var review Review
+
+		err := rows.Scan(
+			&review.ID,
+			&review.BookID,
+			&review.UserID,
+			&review.Score,
+			&review.Body,
+			&review.CreatedAt,
+			&review.UpdatedAt,
+			&review.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		reviews[review.BookID] = append(reviews[review.BookID], &review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return reviews, nil
+}
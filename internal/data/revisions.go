@@ -0,0 +1,245 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// BookSnapshot holds the editable fields of a book as they were at one
+// version.
+type BookSnapshot struct {
+	Title       string      `json:"title"`
+	Authors     BookAuthors `json:"authors"`
+	Rating      float64     `json:"rating"`
+	ISBN        string      `json:"ISBN"`
+	ISBN13      string      `json:"ISBN13"`
+	Language    string      `json:"language"`
+	Description string      `json:"description"`
+	Genres      []string    `json:"genres"`
+	Pages       Pages       `json:"pages"`
+	DeletedAt   *time.Time  `json:"deleted_at,omitempty"`
+}
+
+func (s *BookSnapshot) Scan(src any) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	default:
+		return fmt.Errorf("unsupported type %T for book snapshot", src)
+	}
+}
+
+// ApplyTo copies the snapshot onto book, leaving its identity, version, trash
+// state and rating untouched. The rating is the average of the reviews of the
+// book, so it isn't reverted along with the rest.
+func (s BookSnapshot) ApplyTo(book *Book) {
+	book.Title = s.Title
+	book.Authors = s.Authors
+	book.ISBN = s.ISBN
+	book.ISBN13 = s.ISBN13
+	book.Language = s.Language
+	book.Description = s.Description
+	book.Genres = s.Genres
+	book.Pages = s.Pages
+}
+
+type FieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// Diff lists the fields that differ between s and other, in struct order.
+func (s BookSnapshot) Diff(other BookSnapshot) []FieldChange {
+	changes := []FieldChange{}
+
+	from := reflect.ValueOf(s)
+	to := reflect.ValueOf(other)
+	for i := 0; i < from.NumField(); i++ {
+		if reflect.DeepEqual(from.Field(i).Interface(), to.Field(i).Interface()) {
+			continue
+		}
+		field := strings.Split(from.Type().Field(i).Tag.Get("json"), ",")[0]
+		changes = append(changes, FieldChange{
+			Field: field,
+			From:  from.Field(i).Interface(),
+			To:    to.Field(i).Interface(),
+		})
+	}
+	return changes
+}
+
+type BookRevision struct {
+	BookID    int64        `json:"book_id"`
+	Version   int32        `json:"version"`
+	UserID    *int64       `json:"user_id"`
+	CreatedAt time.Time    `json:"created_at"`
+	Book      BookSnapshot `json:"book"`
+}
+
+// bookSnapshotColumn builds a BookSnapshot of the books row in scope.
+var bookSnapshotColumn = fmt.Sprintf(`
+			jsonb_build_object(
+				'title', title,
+				'authors', %s,
+				'rating', rating,
+				'ISBN', isbn,
+				'ISBN13', isbn13,
+				'language', language,
+				'description', description,
+				'genres', genres,
+				'pages', pages || ' pages',
+				'deleted_at', deleted_at
+			)`, bookAuthorsColumn)
+
+// insertBookRevisions records the current state of each of the given books
+// as a revision made by userID. It must run in the same transaction as the
+// change that bumped their version.
+func insertBookRevisions(ctx context.Context, tx *sql.Tx, userID int64, bookIDs []int64) error {
+	query := fmt.Sprintf(`
+			INSERT INTO book_revisions (book_id, version, user_id, data)
+			SELECT id, version, NULLIF($1, 0), %s
+			FROM books
+			WHERE id = ANY($2)`, bookSnapshotColumn)
+
+	_, err := tx.ExecContext(ctx, query, userID, pq.Array(bookIDs))
+	return err
+}
+
+type BookRevisionModel struct {
+	DB *sql.DB
+}
+
+func (m BookRevisionModel) Get(bookID int64, version int32) (*BookRevision, error) {
+	if bookID < 1 || version < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+			SELECT book_id, version, user_id, created_at, data
+			FROM book_revisions
+			WHERE book_id = $1 AND version = $2`
+
+	var revision BookRevision
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, bookID, version).Scan(
+		&revision.BookID,
+		&revision.Version,
+		&revision.UserID,
+		&revision.CreatedAt,
+		&revision.Book,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &revision, nil
+}
+
+func (m BookRevisionModel) GetAllForBook(bookID int64, filters Filters) ([]*BookRevision, Metadata, error) {
+	query := fmt.Sprintf(`
+			SELECT count(*) OVER(), book_id, version, user_id, created_at, data
+			FROM book_revisions
+			WHERE book_id = $1
+			ORDER BY %s %s
+			LIMIT $2 OFFSET $3`,
+		filters.sortColumn(),
+		filters.sortDirection(),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, bookID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	revisions := []*BookRevision{}
+
+	for rows.Next() {
+		var revision BookRevision
+
+		err := rows.Scan(
+			&totalRecords,
+			&revision.BookID,
+			&revision.Version,
+			&revision.UserID,
+			&revision.CreatedAt,
+			&revision.Book,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		revisions = append(revisions, &revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return revisions, metadata, nil
+}
+
+// GetLatestForBooks returns up to limit of the most recent revisions of each
+// of the given books, newest first, keyed by book ID.
+func (m BookRevisionModel) GetLatestForBooks(bookIDs []int64, limit int) (map[int64][]*BookRevision, error) {
+	query := `
+			SELECT book_id, version, user_id, created_at, data
+			FROM (
+				SELECT *, row_number() OVER (PARTITION BY book_id ORDER BY version DESC) AS n
+				FROM book_revisions
+				WHERE book_id = ANY($1)
+			) AS latest
+			WHERE n <= $2
+			ORDER BY book_id, version DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(bookIDs), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := make(map[int64][]*BookRevision, len(bookIDs))
+
+	for rows.Next() {
+		var revision BookRevision
+
+		err := rows.Scan(
+			&revision.BookID,
+			&revision.Version,
+			&revision.UserID,
+			&revision.CreatedAt,
+			&revision.Book,
+		)
+		if err != nil {
+			return nil, err
+		}
+		revisions[revision.BookID] = append(revisions[revision.BookID], &revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
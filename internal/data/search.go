@@ -0,0 +1,147 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+const (
+	CompletionTitle  = "title"
+	CompletionAuthor = "author"
+	CompletionGenre  = "genre"
+)
+
+var CompletionTypes = []string{CompletionTitle, CompletionAuthor, CompletionGenre}
+
+// MinTitlePrefixLength is the number of characters a title prefix needs to
+// have. Title completions are ranked by rating, which means sorting every
+// matching book, so the prefix has to narrow the matches down first.
+const MinTitlePrefixLength = 3
+
+// Completion is one typeahead suggestion. ID is the book or author it refers
+// to and Count the number of books behind an author or genre.
+type Completion struct {
+	Value string `json:"value"`
+	ID    int64  `json:"id,omitempty"`
+	Count int    `json:"count,omitempty"`
+}
+
+type SearchModel struct {
+	DB *sql.DB
+}
+
+// Complete returns up to limit completions of the given type that start with
+// prefix, case-insensitively. Titles, author names and genres are looked up
+// through lower(...) text_pattern_ops indexes; genres come from the genres
+// table, which keeps count of the books in each of them. Books in the trash
+// don't count.
+func (m SearchModel) Complete(completionType, prefix string, limit int) ([]Completion, error) {
+	var query string
+
+	switch completionType {
+	case CompletionAuthor:
+		query = `
+			SELECT authors.name, authors.id, count(books.id)
+			FROM authors
+			LEFT JOIN book_authors ON book_authors.author_id = authors.id
+			LEFT JOIN books ON books.id = book_authors.book_id AND books.deleted_at IS NULL
+			WHERE lower(authors.name::text) LIKE $1
+			GROUP BY authors.id
+			ORDER BY count(books.id) DESC, authors.name ASC
+			LIMIT $2`
+	case CompletionGenre:
+		query = `
+			SELECT name, 0, books
+			FROM genres
+			WHERE lower(name) LIKE $1 AND books > 0
+			ORDER BY books DESC, name ASC
+			LIMIT $2`
+	default:
+		query = `
+			SELECT title, id, 0
+			FROM books
+			WHERE lower(title) LIKE $1 AND deleted_at IS NULL
+			ORDER BY rating DESC, title ASC
+			LIMIT $2`
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, likePrefix(prefix), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	completions := []Completion{}
+
+	for rows.Next() {
+		var completion Completion
+
+		err := rows.Scan(&completion.Value, &completion.ID, &completion.Count)
+		if err != nil {
+			return nil, err
+		}
+		completions = append(completions, completion)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return completions, nil
+}
+
+// likePrefix turns prefix into a lower-cased LIKE pattern that matches
+// values starting with it, escaping the LIKE wildcards.
+func likePrefix(prefix string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(prefix))
+	return escaped + "%"
+}
+
+const (
+	FacetGenres   = "genres"
+	FacetLanguage = "language"
+	FacetRating   = "rating"
+	FacetPages    = "pages"
+)
+
+var FacetNames = []string{FacetGenres, FacetLanguage, FacetRating, FacetPages}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Facets maps a facet name to its value counts. Genres and languages are
+// ordered by count; rating and page buckets by their range.
+type Facets map[string][]FacetCount
+
+// facetQueries aggregate one facet each over the "matched" CTE. The third
+// column orders the buckets of the range facets.
+var facetQueries = map[string]string{
+	FacetGenres: `
+				SELECT 'genres', genre, 0, count(*)
+				FROM matched, unnest(genres) AS genre
+				GROUP BY genre`,
+	FacetLanguage: `
+				SELECT 'language', language, 0, count(*)
+				FROM matched
+				GROUP BY language`,
+	FacetRating: `
+				SELECT 'rating', bucket || '-' || (bucket + 1), bucket, count(*)
+				FROM matched, LATERAL (SELECT LEAST(floor(rating)::int, 4) AS bucket) AS buckets
+				GROUP BY bucket`,
+	FacetPages: `
+				SELECT 'pages', label, bucket, count(*)
+				FROM matched, LATERAL (SELECT CASE
+					WHEN pages < 100 THEN 0
+					WHEN pages < 200 THEN 1
+					WHEN pages < 300 THEN 2
+					WHEN pages < 500 THEN 3
+					ELSE 4 END AS bucket) AS buckets,
+				LATERAL (SELECT (ARRAY['1-99', '100-199', '200-299', '300-499', '500+'])[bucket + 1] AS label) AS labels
+				GROUP BY bucket, label`,
+}
@@ -0,0 +1,324 @@
+package data
+
+import (
+	"Books/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDuplicateShelf = errors.New("duplicate shelf")
+)
+
+// The reading shelves every user has. A book is on at most one of them at a
+// time; custom shelves hold any number of books without that restriction.
+const (
+	ShelfWantToRead       = "want-to-read"
+	ShelfCurrentlyReading = "currently-reading"
+	ShelfRead             = "read"
+)
+
+var ReadingShelves = []string{ShelfWantToRead, ShelfCurrentlyReading, ShelfRead}
+
+// Shelf is one of the shelves of a user. Exclusive marks the reading shelves,
+// which can't be renamed or deleted. Books is the number of books on it.
+type Shelf struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Exclusive bool      `json:"exclusive"`
+	Books     int       `json:"books"`
+	Version   int32     `json:"version"`
+}
+
+// IsReadingShelf reports whether name is one of the reading shelves, which
+// shelf names match case-insensitively.
+func IsReadingShelf(name string) bool {
+	return validator.PermittedValue(strings.ToLower(name), ReadingShelves...)
+}
+
+func ValidateShelf(v *validator.Validator, shelf *Shelf) {
+	ValidateShelfName(v, "name", shelf.Name)
+	v.Check(!IsReadingShelf(shelf.Name), "name", "is reserved for a built-in shelf")
+}
+
+// ValidateShelfName checks that name can be used in the URL of a shelf,
+// recording any errors under key.
+func ValidateShelfName(v *validator.Validator, key, name string) {
+	v.Check(strings.TrimSpace(name) != "", key, "must be provided")
+	v.Check(len(name) <= 100, key, "must not be more than 100 bytes long")
+	v.Check(!strings.Contains(name, "/"), key, "must not contain slashes")
+}
+
+// ShelfEntry puts a book on the shelf with the given name, along with the
+// user's own rating of it from 1 to 5, or 0 for none.
+type ShelfEntry struct {
+	Shelf  string
+	BookID int64
+	Rating int
+}
+
+type ShelfModel struct {
+	DB *sql.DB
+}
+
+// AddEntries puts books on the shelves of a user, creating the shelves that
+// don't exist yet. A book put on a reading shelf is taken off the other
+// reading shelves of the user. Each book must appear at most once per shelf.
+func (m ShelfModel) AddEntries(userID int64, entries []ShelfEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	names := make([]string, len(entries))
+	bookIDs := make([]int64, len(entries))
+	ratings := make([]int32, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Shelf
+		bookIDs[i] = entry.BookID
+		ratings[i] = int32(entry.Rating)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+			INSERT INTO shelves (user_id, name, exclusive)
+			SELECT DISTINCT $1::bigint, name, name = ANY($3::citext[])
+			FROM unnest($2::citext[]) AS name
+			ON CONFLICT ON CONSTRAINT shelves_user_id_name_key DO NOTHING`
+
+	_, err = tx.ExecContext(ctx, query, userID, pq.Array(names), pq.Array(ReadingShelves))
+	if err != nil {
+		return err
+	}
+
+	query = `
+			DELETE FROM shelf_books
+			USING shelves, unnest($2::bigint[], $3::citext[]) AS entries (book_id, name)
+			WHERE shelf_books.shelf_id = shelves.id
+				AND shelves.user_id = $1
+				AND shelves.exclusive
+				AND shelf_books.book_id = entries.book_id
+				AND shelves.name <> entries.name
+				AND entries.name = ANY($4::citext[])`
+
+	_, err = tx.ExecContext(ctx, query, userID, pq.Array(bookIDs), pq.Array(names), pq.Array(ReadingShelves))
+	if err != nil {
+		return err
+	}
+
+	query = `
+			INSERT INTO shelf_books (shelf_id, book_id, rating)
+			SELECT shelves.id, entries.book_id, NULLIF(entries.rating, 0)
+			FROM unnest($2::bigint[], $3::citext[], $4::integer[]) AS entries (book_id, name, rating)
+			INNER JOIN shelves ON shelves.user_id = $1 AND shelves.name = entries.name
+			ON CONFLICT (shelf_id, book_id) DO UPDATE
+			SET rating = COALESCE(EXCLUDED.rating, shelf_books.rating)`
+
+	_, err = tx.ExecContext(ctx, query, userID, pq.Array(bookIDs), pq.Array(names), pq.Array(ratings))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// shelfBooksColumn counts the books on the shelves row in scope, leaving out
+// the books in the trash.
+const shelfBooksColumn = `
+			(
+				SELECT count(*)
+				FROM shelf_books
+				INNER JOIN books ON books.id = shelf_books.book_id
+				WHERE shelf_books.shelf_id = shelves.id AND books.deleted_at IS NULL
+			)`
+
+// createReadingShelves creates those of the reading shelves of a user that
+// don't exist yet. They are created on first use rather than with the user.
+func (m ShelfModel) createReadingShelves(ctx context.Context, userID int64) error {
+	query := `
+			INSERT INTO shelves (user_id, name, exclusive)
+			SELECT $1, name, true
+			FROM unnest($2::citext[]) AS name
+			ON CONFLICT ON CONSTRAINT shelves_user_id_name_key DO NOTHING`
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(ReadingShelves))
+	return err
+}
+
+// GetAllForUser lists the shelves of a user, the reading shelves first.
+func (m ShelfModel) GetAllForUser(userID int64) ([]*Shelf, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.createReadingShelves(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+			SELECT id, created_at, name, exclusive, ` + shelfBooksColumn + `, version
+			FROM shelves
+			WHERE user_id = $1
+			ORDER BY array_position($2::citext[], name) NULLS LAST, name ASC`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, pq.Array(ReadingShelves))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shelves := []*Shelf{}
+
+	for rows.Next() {
+		var shelf Shelf
+
+		err := rows.Scan(&shelf.ID, &shelf.CreatedAt, &shelf.Name, &shelf.Exclusive, &shelf.Books, &shelf.Version)
+		if err != nil {
+			return nil, err
+		}
+		shelves = append(shelves, &shelf)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return shelves, nil
+}
+
+// GetForUser returns the shelf of a user with the given name.
+func (m ShelfModel) GetForUser(userID int64, name string) (*Shelf, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if IsReadingShelf(name) {
+		err := m.createReadingShelves(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	query := `
+			SELECT id, created_at, name, exclusive, ` + shelfBooksColumn + `, version
+			FROM shelves
+			WHERE user_id = $1 AND name = $2`
+
+	var shelf Shelf
+
+	err := m.DB.QueryRowContext(ctx, query, userID, name).Scan(
+		&shelf.ID,
+		&shelf.CreatedAt,
+		&shelf.Name,
+		&shelf.Exclusive,
+		&shelf.Books,
+		&shelf.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &shelf, nil
+}
+
+func (m ShelfModel) Insert(userID int64, shelf *Shelf) error {
+	query := `
+			INSERT INTO shelves (user_id, name)
+			VALUES ($1, $2)
+			RETURNING id, created_at, name, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, strings.TrimSpace(shelf.Name)).Scan(&shelf.ID, &shelf.CreatedAt, &shelf.Name, &shelf.Version)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err, "shelves_user_id_name_key"):
+			return ErrDuplicateShelf
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Update renames a custom shelf.
+func (m ShelfModel) Update(shelf *Shelf) error {
+	query := `
+			UPDATE shelves
+			SET name = $1, version = version + 1
+			WHERE id = $2 AND version = $3 AND NOT exclusive
+			RETURNING name, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, strings.TrimSpace(shelf.Name), shelf.ID, shelf.Version).Scan(&shelf.Name, &shelf.Version)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err, "shelves_user_id_name_key"):
+			return ErrDuplicateShelf
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete deletes a custom shelf along with its list of books.
+func (m ShelfModel) Delete(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM shelves WHERE id = $1 AND NOT exclusive`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// RemoveBook takes a book off a shelf.
+func (m ShelfModel) RemoveBook(shelfID, bookID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM shelf_books WHERE shelf_id = $1 AND book_id = $2`, shelfID, bookID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
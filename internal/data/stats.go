@@ -0,0 +1,160 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PeriodStats counts the books a user finished in a year, or in one month of
+// it, and the pages in them.
+type PeriodStats struct {
+	Year  int `json:"year"`
+	Month int `json:"month,omitempty"`
+	Books int `json:"books"`
+	Pages int `json:"pages"`
+}
+
+type GenreStats struct {
+	Genre string `json:"genre"`
+	Books int    `json:"books"`
+}
+
+// ReadingStats sums up the reading of a user. Streaks are runs of consecutive
+// days with recorded progress; the current streak is still running if the
+// user recorded progress today or yesterday.
+type ReadingStats struct {
+	Years         []PeriodStats `json:"years"`
+	Months        []PeriodStats `json:"months"`
+	AverageRating float64       `json:"average_rating"`
+	Ratings       int           `json:"ratings"`
+	Genres        []GenreStats  `json:"genres"`
+	CurrentStreak int           `json:"current_streak"`
+	LongestStreak int           `json:"longest_streak"`
+}
+
+type StatsModel struct {
+	DB *sql.DB
+}
+
+func (m StatsModel) GetForUser(userID int64) (*ReadingStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stats := &ReadingStats{
+		Years:  []PeriodStats{},
+		Months: []PeriodStats{},
+		Genres: []GenreStats{},
+	}
+
+	err := m.getPeriods(ctx, userID, stats)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.getGenres(ctx, userID, stats)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+			SELECT COALESCE(avg(score), 0), count(*)
+			FROM reviews
+			WHERE user_id = $1`
+
+	err = m.DB.QueryRowContext(ctx, query, userID).Scan(&stats.AverageRating, &stats.Ratings)
+	if err != nil {
+		return nil, err
+	}
+
+	// Consecutive days minus their row number land on the same date, which
+	// groups each streak together.
+	query = `
+			SELECT COALESCE(max(length) FILTER (WHERE last_day >= (NOW() AT TIME ZONE 'UTC')::date - 1), 0),
+				COALESCE(max(length), 0)
+			FROM (
+				SELECT count(*) AS length, max(day) AS last_day
+				FROM (
+					SELECT day, day - (row_number() OVER (ORDER BY day))::integer AS streak
+					FROM reading_days
+					WHERE user_id = $1
+				) AS days
+				GROUP BY streak
+			) AS streaks`
+
+	err = m.DB.QueryRowContext(ctx, query, userID).Scan(&stats.CurrentStreak, &stats.LongestStreak)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// getPeriods counts the finished books of a user by month, and adds the months
+// up into years.
+func (m StatsModel) getPeriods(ctx context.Context, userID int64, stats *ReadingStats) error {
+	query := `
+			SELECT extract(year FROM reading_progress.finished_at)::integer AS year,
+				extract(month FROM reading_progress.finished_at)::integer AS month,
+				count(*),
+				COALESCE(sum(books.pages), 0)
+			FROM reading_progress
+			INNER JOIN books ON books.id = reading_progress.book_id
+			WHERE reading_progress.user_id = $1 AND reading_progress.finished_at IS NOT NULL
+			GROUP BY year, month
+			ORDER BY year, month`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var month PeriodStats
+
+		err := rows.Scan(&month.Year, &month.Month, &month.Books, &month.Pages)
+		if err != nil {
+			return err
+		}
+		stats.Months = append(stats.Months, month)
+
+		if n := len(stats.Years); n == 0 || stats.Years[n-1].Year != month.Year {
+			stats.Years = append(stats.Years, PeriodStats{Year: month.Year})
+		}
+		year := &stats.Years[len(stats.Years)-1]
+		year.Books += month.Books
+		year.Pages += month.Pages
+	}
+	return rows.Err()
+}
+
+// getGenres counts the finished books of a user in each genre, the most read
+// genres first.
+func (m StatsModel) getGenres(ctx context.Context, userID int64, stats *ReadingStats) error {
+	query := `
+			SELECT genre, count(*) AS books
+			FROM reading_progress
+			INNER JOIN books ON books.id = reading_progress.book_id
+			CROSS JOIN unnest(books.genres) AS genre
+			WHERE reading_progress.user_id = $1 AND reading_progress.finished_at IS NOT NULL
+			GROUP BY genre
+			ORDER BY books DESC, genre ASC`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var genre GenreStats
+
+		err := rows.Scan(&genre.Genre, &genre.Books)
+		if err != nil {
+			return err
+		}
+		stats.Genres = append(stats.Genres, genre)
+	}
+	return rows.Err()
+}
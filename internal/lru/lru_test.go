@@ -0,0 +1,88 @@
+package lru
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	type op struct {
+		add    bool
+		key    string
+		value  int
+		wantOK bool
+	}
+
+	tests := []struct {
+		name string
+		size int
+		ops  []op
+	}{
+		{"miss", 2, []op{
+			{key: "a"},
+		}},
+		{"hit", 2, []op{
+			{add: true, key: "a", value: 1},
+			{key: "a", value: 1, wantOK: true},
+		}},
+		{"overwrite", 2, []op{
+			{add: true, key: "a", value: 1},
+			{add: true, key: "a", value: 2},
+			{key: "a", value: 2, wantOK: true},
+		}},
+		{"evicts least recently added", 2, []op{
+			{add: true, key: "a", value: 1},
+			{add: true, key: "b", value: 2},
+			{add: true, key: "c", value: 3},
+			{key: "a"},
+			{key: "b", value: 2, wantOK: true},
+			{key: "c", value: 3, wantOK: true},
+		}},
+		{"get refreshes recency", 2, []op{
+			{add: true, key: "a", value: 1},
+			{add: true, key: "b", value: 2},
+			{key: "a", value: 1, wantOK: true},
+			{add: true, key: "c", value: 3},
+			{key: "b"},
+			{key: "a", value: 1, wantOK: true},
+		}},
+		{"add refreshes recency", 2, []op{
+			{add: true, key: "a", value: 1},
+			{add: true, key: "b", value: 2},
+			{add: true, key: "a", value: 4},
+			{add: true, key: "c", value: 3},
+			{key: "b"},
+			{key: "a", value: 4, wantOK: true},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New[string, int](tt.size, time.Minute)
+
+			for i, o := range tt.ops {
+				if o.add {
+					c.Add(o.key, o.value)
+					continue
+				}
+
+				got, ok := c.Get(o.key)
+				if ok != o.wantOK || got != o.value {
+					t.Errorf("op %d: Get(%q) = %d, %t; want %d, %t", i, o.key, got, ok, o.value, o.wantOK)
+				}
+			}
+		})
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	c := New[string, int](2, -time.Second)
+	c.Add("a", 1)
+
+	if got, ok := c.Get("a"); ok {
+		t.Errorf("Get(%q) = %d, true; want an expired miss", "a", got)
+	}
+	if n := c.order.Len(); n != 0 {
+		t.Errorf("got %d entries after expiry; want 0", n)
+	}
+}
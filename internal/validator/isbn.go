@@ -0,0 +1,94 @@
+package validator
+
+import (
+	"strings"
+)
+
+// NormalizeISBN strips the hyphens and spaces that are commonly used to group
+// the digits of an ISBN and upper-cases a trailing ISBN-10 'x' check digit.
+func NormalizeISBN(isbn string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(isbn)))
+}
+
+// ValidISBN10 reports whether isbn is a normalized ISBN-10 with a correct
+// mod-11 check digit.
+func ValidISBN10(isbn string) bool {
+	if len(isbn) != 10 {
+		return false
+	}
+
+	sum := 0
+	for i := 0; i < 10; i++ {
+		var d int
+		switch c := isbn[i]; {
+		case c >= '0' && c <= '9':
+			d = int(c - '0')
+		case c == 'X' && i == 9:
+			d = 10
+		default:
+			return false
+		}
+		sum += (10 - i) * d
+	}
+	return sum%11 == 0
+}
+
+// ValidISBN13 reports whether isbn is a normalized ISBN-13 with a correct
+// mod-10 check digit and a 978 or 979 prefix.
+func ValidISBN13(isbn string) bool {
+	if len(isbn) != 13 || !isDigits(isbn) {
+		return false
+	}
+	if !strings.HasPrefix(isbn, "978") && !strings.HasPrefix(isbn, "979") {
+		return false
+	}
+	return isbn13CheckDigit(isbn[:12]) == isbn[12]
+}
+
+// ISBN10To13 converts a valid ISBN-10 to its ISBN-13 form.
+func ISBN10To13(isbn string) string {
+	body := "978" + isbn[:9]
+	return body + string(isbn13CheckDigit(body))
+}
+
+// ISBN13To10 converts a valid ISBN-13 to its ISBN-10 form. Only 978-prefixed
+// numbers have an ISBN-10 equivalent; ok is false for any other number, and
+// for anything that isn't thirteen digits long.
+func ISBN13To10(isbn string) (string, bool) {
+	if len(isbn) != 13 || !isDigits(isbn) || !strings.HasPrefix(isbn, "978") {
+		return "", false
+	}
+
+	body := isbn[3:12]
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += (10 - i) * int(body[i]-'0')
+	}
+
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return body + "X", true
+	}
+	return body + string(rune('0'+check)), true
+}
+
+func isbn13CheckDigit(body string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := int(body[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
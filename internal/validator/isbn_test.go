@@ -0,0 +1,107 @@
+package validator
+
+import "testing"
+
+func TestNormalizeISBN(t *testing.T) {
+	tests := []struct {
+		isbn string
+		want string
+	}{
+		{"978-0-306-40615-7", "9780306406157"},
+		{" 0 306 40615 2 ", "0306406152"},
+		{"0-8044-2957-x", "080442957X"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeISBN(tt.isbn); got != tt.want {
+			t.Errorf("NormalizeISBN(%q) = %q; want %q", tt.isbn, got, tt.want)
+		}
+	}
+}
+
+func TestValidISBN10(t *testing.T) {
+	tests := []struct {
+		isbn string
+		want bool
+	}{
+		{"0306406152", true},
+		{"080442957X", true},
+		{"0306406153", false},
+		{"08044295X7", false},
+		{"030640615", false},
+		{"03064061522", false},
+		{"03064O6152", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidISBN10(tt.isbn); got != tt.want {
+			t.Errorf("ValidISBN10(%q) = %t; want %t", tt.isbn, got, tt.want)
+		}
+	}
+}
+
+func TestValidISBN13(t *testing.T) {
+	tests := []struct {
+		isbn string
+		want bool
+	}{
+		{"9780306406157", true},
+		{"9791090636071", true},
+		{"9780306406158", false},
+		{"9770306406150", false},
+		{"978030640615", false},
+		{"97803064061570", false},
+		{"978030640615X", false},
+		{"978", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidISBN13(tt.isbn); got != tt.want {
+			t.Errorf("ValidISBN13(%q) = %t; want %t", tt.isbn, got, tt.want)
+		}
+	}
+}
+
+func TestISBN10To13(t *testing.T) {
+	tests := []struct {
+		isbn string
+		want string
+	}{
+		{"0306406152", "9780306406157"},
+		{"080442957X", "9780804429573"},
+	}
+
+	for _, tt := range tests {
+		if got := ISBN10To13(tt.isbn); got != tt.want {
+			t.Errorf("ISBN10To13(%q) = %q; want %q", tt.isbn, got, tt.want)
+		}
+	}
+}
+
+func TestISBN13To10(t *testing.T) {
+	tests := []struct {
+		isbn   string
+		want   string
+		wantOK bool
+	}{
+		{"9780306406157", "0306406152", true},
+		{"9780804429573", "080442957X", true},
+		{"9791090636071", "", false},
+		{"978", "", false},
+		{"9781", "", false},
+		{"978030640615", "", false},
+		{"97803064061570", "", false},
+		{"978abcdefghij", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ISBN13To10(tt.isbn)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("ISBN13To10(%q) = %q, %t; want %q, %t", tt.isbn, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
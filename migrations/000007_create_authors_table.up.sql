@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS authors (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name citext UNIQUE NOT NULL,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS book_authors (
+    book_id bigint NOT NULL REFERENCES books ON DELETE CASCADE,
+    author_id bigint NOT NULL REFERENCES authors ON DELETE RESTRICT,
+    position integer NOT NULL,
+    role text NOT NULL DEFAULT 'author',
+    PRIMARY KEY (book_id, author_id, role),
+    CONSTRAINT book_authors_role_check CHECK (role IN ('author', 'translator', 'editor', 'illustrator'))
+);
+
+CREATE INDEX IF NOT EXISTS book_authors_author_id_idx ON book_authors (author_id);
+
+INSERT INTO authors (name)
+SELECT DISTINCT trim(name)
+FROM books, unnest(string_to_array(books.authors, ',')) AS name
+WHERE trim(name) <> ''
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO book_authors (book_id, author_id, position, role)
+SELECT books.id, authors.id, min(parts.position), 'author'
+FROM books
+CROSS JOIN LATERAL unnest(string_to_array(books.authors, ',')) WITH ORDINALITY AS parts(name, position)
+INNER JOIN authors ON authors.name = trim(parts.name)
+GROUP BY books.id, authors.id;
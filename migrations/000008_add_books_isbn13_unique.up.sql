@@ -0,0 +1,17 @@
+UPDATE books
+SET isbn = upper(regexp_replace(isbn, '[\s-]', '', 'g')),
+    isbn13 = upper(regexp_replace(isbn13, '[\s-]', '', 'g'));
+
+-- Books that share an ISBN-13 with an older book lose it, so that the index
+-- can be built. They have to be given their own ISBN-13 the next time they
+-- are edited, since a book can't be saved without one.
+UPDATE books
+SET isbn13 = ''
+FROM (
+    SELECT id, row_number() OVER (PARTITION BY isbn13 ORDER BY id) AS n
+    FROM books
+    WHERE isbn13 <> ''
+) AS duplicates
+WHERE books.id = duplicates.id AND duplicates.n > 1;
+
+CREATE UNIQUE INDEX IF NOT EXISTS books_isbn13_key ON books (isbn13) WHERE isbn13 <> '';
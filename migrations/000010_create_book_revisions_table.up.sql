@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS book_revisions (
+    book_id bigint NOT NULL REFERENCES books ON DELETE CASCADE,
+    version integer NOT NULL,
+    user_id bigint REFERENCES users ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    data jsonb NOT NULL,
+    PRIMARY KEY (book_id, version)
+);
+
+INSERT INTO book_revisions (book_id, version, created_at, data)
+SELECT id, version, created_at, jsonb_build_object(
+    'title', title,
+    'authors', COALESCE((
+        SELECT json_agg(json_build_object('id', authors.id, 'name', authors.name, 'role', book_authors.role) ORDER BY book_authors.position)
+        FROM book_authors
+        INNER JOIN authors ON authors.id = book_authors.author_id
+        WHERE book_authors.book_id = books.id
+    ), '[]'),
+    'rating', rating,
+    'ISBN', isbn,
+    'ISBN13', isbn13,
+    'language', language,
+    'genres', genres,
+    'pages', pages || ' pages',
+    'deleted_at', deleted_at
+)
+FROM books;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS authors_name_trgm_idx;
+DROP INDEX IF EXISTS books_authors_trgm_idx;
+DROP INDEX IF EXISTS books_title_trgm_idx;
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS books_count_genres ON books;
+DROP FUNCTION IF EXISTS books_count_genres();
+DROP TABLE IF EXISTS genres;
+DROP INDEX IF EXISTS authors_name_prefix_idx;
+DROP INDEX IF EXISTS books_title_prefix_idx;
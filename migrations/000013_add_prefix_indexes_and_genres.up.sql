@@ -0,0 +1,47 @@
+CREATE INDEX IF NOT EXISTS books_title_prefix_idx ON books (lower(title) text_pattern_ops) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS authors_name_prefix_idx ON authors (lower(name::text) text_pattern_ops);
+
+-- genres counts the books in the catalog, outside the trash, in each genre, so
+-- that genres can be completed without unnesting the genres of every book.
+CREATE TABLE IF NOT EXISTS genres (
+    name text PRIMARY KEY,
+    books integer NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS genres_name_prefix_idx ON genres (lower(name) text_pattern_ops);
+
+-- The rows of a book's genres are locked in name order, so books with the same
+-- genres can be written at the same time without deadlocking.
+CREATE OR REPLACE FUNCTION books_count_genres() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        IF OLD.deleted_at IS NULL THEN
+            PERFORM 1 FROM genres WHERE name = ANY (OLD.genres) ORDER BY name FOR UPDATE;
+            UPDATE genres SET books = books - 1 WHERE name = ANY (OLD.genres);
+        END IF;
+    END IF;
+
+    IF TG_OP <> 'DELETE' THEN
+        IF NEW.deleted_at IS NULL THEN
+            INSERT INTO genres (name, books)
+            SELECT DISTINCT genre, 1
+            FROM unnest(NEW.genres) AS genre
+            ORDER BY genre
+            ON CONFLICT (name) DO UPDATE SET books = genres.books + 1;
+        END IF;
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER books_count_genres
+AFTER INSERT OR DELETE OR UPDATE OF genres, deleted_at ON books
+FOR EACH ROW EXECUTE FUNCTION books_count_genres();
+
+INSERT INTO genres (name, books)
+SELECT genre, count(DISTINCT books.id)
+FROM books, unnest(books.genres) AS genre
+WHERE books.deleted_at IS NULL
+GROUP BY genre
+ON CONFLICT (name) DO NOTHING;
@@ -0,0 +1,3 @@
+ALTER TABLE books ALTER COLUMN rating DROP DEFAULT;
+ALTER TABLE books DROP COLUMN IF EXISTS rating_count;
+DROP TABLE IF EXISTS reviews;
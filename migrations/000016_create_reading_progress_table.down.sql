@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS reading_goals;
+DROP TABLE IF EXISTS reading_days;
+DROP TABLE IF EXISTS reading_progress;
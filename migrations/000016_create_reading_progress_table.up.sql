@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS reading_progress (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    book_id bigint NOT NULL REFERENCES books ON DELETE CASCADE,
+    page integer,
+    percent numeric(5, 2) NOT NULL DEFAULT 0,
+    started_at date,
+    finished_at date,
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1,
+    PRIMARY KEY (user_id, book_id),
+    CONSTRAINT reading_progress_page_check CHECK (page >= 0),
+    CONSTRAINT reading_progress_percent_check CHECK (percent BETWEEN 0 AND 100),
+    CONSTRAINT reading_progress_dates_check CHECK (finished_at >= started_at)
+);
+
+CREATE INDEX IF NOT EXISTS reading_progress_user_id_finished_at_idx ON reading_progress (user_id, finished_at);
+
+-- The days on which a user recorded any progress, for reading streaks.
+CREATE TABLE IF NOT EXISTS reading_days (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    day date NOT NULL,
+    PRIMARY KEY (user_id, day)
+);
+
+CREATE TABLE IF NOT EXISTS reading_goals (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    year integer NOT NULL,
+    books integer NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1,
+    PRIMARY KEY (user_id, year),
+    CONSTRAINT reading_goals_books_check CHECK (books > 0)
+);
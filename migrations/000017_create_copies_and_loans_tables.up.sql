@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS copies (
+    id bigserial PRIMARY KEY,
+    book_id bigint NOT NULL REFERENCES books ON DELETE RESTRICT,
+    barcode text NOT NULL,
+    condition text NOT NULL DEFAULT 'good',
+    location text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    withdrawn_at timestamp(0) with time zone,
+    version integer NOT NULL DEFAULT 1,
+    CONSTRAINT copies_condition_check CHECK (condition IN ('new', 'good', 'fair', 'poor', 'damaged'))
+);
+
+-- Withdrawn copies stay behind for their loan history, and their barcodes can
+-- be given to new copies. Books with copies can't be purged from the trash for
+-- the same reason.
+CREATE UNIQUE INDEX IF NOT EXISTS copies_barcode_key ON copies (barcode) WHERE withdrawn_at IS NULL;
+CREATE INDEX IF NOT EXISTS copies_book_id_idx ON copies (book_id);
+
+CREATE TABLE IF NOT EXISTS loans (
+    id bigserial PRIMARY KEY,
+    copy_id bigint NOT NULL REFERENCES copies ON DELETE RESTRICT,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    checked_out_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    due_at timestamp(0) with time zone NOT NULL,
+    renewals integer NOT NULL DEFAULT 0,
+    returned_at timestamp(0) with time zone,
+    reminded_at timestamp(0) with time zone,
+    version integer NOT NULL DEFAULT 1,
+    CONSTRAINT loans_due_at_check CHECK (due_at > checked_out_at),
+    CONSTRAINT loans_returned_at_check CHECK (returned_at >= checked_out_at)
+);
+
+-- A copy can only be out on one loan at a time.
+CREATE UNIQUE INDEX IF NOT EXISTS loans_copy_id_active_key ON loans (copy_id) WHERE returned_at IS NULL;
+CREATE INDEX IF NOT EXISTS loans_user_id_idx ON loans (user_id);
+CREATE INDEX IF NOT EXISTS loans_due_at_active_idx ON loans (due_at) WHERE returned_at IS NULL;
+
+INSERT INTO permissions (code)
+VALUES ('loans:write');
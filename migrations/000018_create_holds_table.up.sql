@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS holds (
+    id bigserial PRIMARY KEY,
+    book_id bigint NOT NULL REFERENCES books ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    status text NOT NULL DEFAULT 'waiting',
+    copy_id bigint REFERENCES copies ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    ready_at timestamp(0) with time zone,
+    expires_at timestamp(0) with time zone,
+    version integer NOT NULL DEFAULT 1,
+    CONSTRAINT holds_status_check CHECK (status IN ('waiting', 'ready', 'fulfilled', 'expired', 'cancelled')),
+    CONSTRAINT holds_ready_check CHECK (status <> 'ready' OR (copy_id IS NOT NULL AND expires_at IS NOT NULL))
+);
+
+-- A user queues for a book at most once at a time, and a copy is kept for at
+-- most one of them.
+CREATE UNIQUE INDEX IF NOT EXISTS holds_book_id_user_id_active_key ON holds (book_id, user_id) WHERE status IN ('waiting', 'ready');
+CREATE UNIQUE INDEX IF NOT EXISTS holds_copy_id_ready_key ON holds (copy_id) WHERE status = 'ready';
+
+CREATE INDEX IF NOT EXISTS holds_book_id_waiting_idx ON holds (book_id, id) WHERE status = 'waiting';
+CREATE INDEX IF NOT EXISTS holds_expires_at_ready_idx ON holds (expires_at) WHERE status = 'ready';
+CREATE INDEX IF NOT EXISTS holds_user_id_idx ON holds (user_id);